@@ -0,0 +1,157 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"unicode"
+)
+
+//Generates getters and setters for the unexported fields of spec structs, e.g. for
+//	type Config struct{ timeout time.Duration }
+//Config gets Timeout() time.Duration and SetTimeout(timeout time.Duration)
+//Exported fields already have both, and a getter named after one would clash with it
+type Accessors struct {
+	fieldSelection
+}
+
+//Which structs and fields a struct transform generates for
+type fieldSelection struct {
+	//Spec package, so embedded structs can be declared anywhere in it, see NewPackageContext
+	Package *Context
+	//Structs to generate for. Every struct in the spec file when empty
+	Types []string
+	//Fields to generate for by name, every field when empty. Excluded fields are left out either way
+	Include, Exclude []string
+}
+
+func NewAccessors(pkg *Context, types, include, exclude []string) *Accessors {
+	return &Accessors{fieldSelection{pkg, types, include, exclude}}
+}
+
+//The structs of a spec file that are selected for generation
+func (s fieldSelection) structs(spec *Context) (names []string, structs []*ast.StructType) {
+	var types typeSet = spec.Types()
+	types.Each(func(t *ast.TypeSpec) {
+		st, isStruct := t.Type.(*ast.StructType)
+		if isStruct && t.TypeParams == nil && (len(s.Types) == 0 || containsString(s.Types, t.Name.Name)) {
+			names, structs = append(names, t.Name.Name), append(structs, st)
+		}
+	})
+	return
+}
+
+//The selected fields of a struct, including those promoted from embedded structs, see FieldsOf
+//Fields promoted through an embedded pointer are left out, since selecting them could dereference nil
+func (s fieldSelection) fields(st *ast.StructType) (fields []StructField) {
+	for _, f := range s.Package.FieldsOf(st) {
+		if f.Name == "_" || containsString(s.Exclude, f.Name) || (len(s.Include) != 0 && !containsString(s.Include, f.Name)) {
+			continue
+		}
+
+		throughPointer := false
+		for _, embedded := range f.Path {
+			throughPointer = throughPointer || isPointer(embedded.Type)
+		}
+		if !throughPointer {
+			fields = append(fields, f)
+		}
+	}
+	return
+}
+
+//Whether a struct already has a field or method by a name, so it can't be given a method by that name
+func (s fieldSelection) declares(name string, st *ast.StructType, member string) bool {
+	if _, exists := s.Package.LookupMethod(name, member); exists {
+		return true
+	}
+	_, exists := s.Package.LookupField(st, member)
+	return exists
+}
+
+//A parameter name for a field's value, which has to be a valid identifier that doesn't clash with the receiver
+func paramName(field, rcvr string) string {
+	r := []rune(field)
+	r[0] = unicode.ToLower(r[0])
+	name := string(r)
+	if token.Lookup(name).IsKeyword() || name == rcvr {
+		return "value"
+	}
+	return name
+}
+
+func (a *Accessors) Transform(spec *Context) (codes SourceSet, ok bool, errors []error) {
+	names, structs := a.structs(spec)
+	for i, name := range names {
+		var (
+			st            = structs[i]
+			rcvr, pointer = receiverOf(a.Package, name)
+			recvType      = name
+			imports       ImportSpecs
+			decls         bytes.Buffer
+		)
+		if pointer {
+			recvType = "*" + name
+		}
+
+		for _, f := range a.fields(st) {
+			if ast.IsExported(f.Name) {
+				continue
+			}
+
+			getter, typ := callFieldName(f.Name), ExprString(f.Type)
+			if !a.declares(name, st, getter) {
+				fmt.Fprintf(&decls, "\nfunc (%s %s) %s() %s {\n\treturn %s.%s\n}\n", rcvr, recvType, getter, typ, rcvr, f.Name)
+			}
+
+			//Setters need pointer receivers to have any effect
+			if setter, param := "Set"+getter, paramName(f.Name, rcvr); !a.declares(name, st, setter) {
+				fmt.Fprintf(&decls, "\nfunc (%s *%s) %s(%s %s) {\n\t%s.%s = %s\n}\n", rcvr, name, setter, param, typ, rcvr, f.Name, param)
+			}
+			imports = append(imports, a.Package.SelectedImports(f.Type)...)
+		}
+
+		if decls.Len() == 0 {
+			continue
+		}
+		source, err := generatedSource(a.Package, name, imports, decls.Bytes())
+		if err != nil {
+			errors = append(errors, fmt.Errorf("Cannot generate the accessors of %s: %s", name, err))
+			continue
+		}
+		codes = append(codes, source)
+	}
+
+	if len(codes) == 0 && len(errors) == 0 {
+		errors = append(errors, fmt.Errorf("No struct in %s has unexported fields without accessors", spec.File.Name.Name))
+	}
+	ok = len(errors) == 0
+	return
+}
+
+//Generate accessors for the structs of a spec file, written next to it
+func accessors(specFile string, types, include, exclude []string, cfg writeConfig) {
+	fmt.Printf("Accessors %s\n", specFile)
+	cfg.Types = types
+	transformSpec(specFile, "accessors.go", cfg, func(pkg *Context, dir string) AstTransform {
+		return NewAccessors(pkg, types, include, exclude)
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const accessorsSpec = `package app
+
+import "time"
+
+type base struct {
+	id int
+}
+
+type Meta struct {
+	tags []string
+}
+
+type Config struct {
+	base
+	*Meta
+	Name    string
+	timeout time.Duration
+	retries int
+}
+
+func (c *Config) Retries() int { return c.retries }
+
+type point struct{ x, y int }
+`
+
+//Transform a spec file, returning the source generated for each type
+func transformedSource(t *testing.T, specSource string, newTransform func(pkg *Context, dir string) AstTransform) map[string]string {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+	writeTestFiles(dir, map[string]string{"app/app.go": specSource})
+	specFile := filepath.Join(dir, "app", "app.go")
+
+	spec, _ := NewFileContext(specFile)
+	pkg, _ := NewPackageContext(specFile, func(string) bool { return false })
+	codes, ok, errors := newTransform(pkg, filepath.Dir(specFile)).Transform(spec)
+	if !ok {
+		t.Fatalf("Expected the transform to succeed, found %v", errors)
+	}
+
+	sources := map[string]string{}
+	for _, code := range codes {
+		var b bytes.Buffer
+		format.Node(&b, code.FileSet, code.File)
+		sources[code.Name] = b.String()
+	}
+	return sources
+}
+
+func Test_Accessors(t *testing.T) {
+	tests := []struct {
+		Types, Include, Exclude []string
+		Name                    string
+		Expect, Reject          []string
+	}{
+		{[]string{"Config"}, nil, nil, "Config",
+			[]string{
+				"import \"time\"",
+				"func (c *Config) Timeout() time.Duration {\n\treturn c.timeout\n}",
+				"func (c *Config) SetTimeout(timeout time.Duration) {\n\tc.timeout = timeout\n}",
+				"func (c *Config) SetRetries(retries int) {",
+				"func (c *Config) Id() int {\n\treturn c.id\n}",
+				"func (c *Config) Base() base {",
+			},
+			[]string{"Name()", "Retries()", "Tags()"},
+		},
+		{[]string{"Config"}, []string{"timeout"}, nil, "Config",
+			[]string{"Timeout()"},
+			[]string{"SetRetries", "Id()"},
+		},
+		{nil, nil, []string{"y"}, "point",
+			[]string{"func (p point) X() int {\n\treturn p.x\n}", "func (p *point) SetX(x int) {"},
+			[]string{"Y()"},
+		},
+	}
+
+	for _, tst := range tests {
+		sources := transformedSource(t, accessorsSpec, func(pkg *Context, dir string) AstTransform {
+			return NewAccessors(pkg, tst.Types, tst.Include, tst.Exclude)
+		})
+		src, found := sources[tst.Name]
+		if !found {
+			t.Errorf("Expected accessors for %s, found %v", tst.Name, sources)
+			continue
+		}
+		for _, expect := range tst.Expect {
+			if !strings.Contains(src, expect) {
+				t.Errorf("Expected the accessors of %s to contain\n%s\nfound\n%s", tst.Name, expect, src)
+			}
+		}
+		for _, reject := range tst.Reject {
+			if strings.Contains(src, reject) {
+				t.Errorf("Expected the accessors of %s not to contain %s, found\n%s", tst.Name, reject, src)
+			}
+		}
+	}
+}
@@ -0,0 +1,268 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//Methods can only be declared on an alias of a type declared in the spec package, so spec aliases are resolved
+//before they implement anything. An alias of a spec type is implemented as the type it aliases, while an alias of
+//an unnamed type, a predeclared type or a type of another package can only be implemented by a defined type
+//declared in its place, which it can be converted to and from
+//	type Users = []*pb.User
+//becomes
+//	type UsersWrapper []*pb.User
+//	func WrapUsers(x Users) UsersWrapper { return UsersWrapper(x) }
+//	func (w UsersWrapper) Unwrap() Users { return Users(w) }
+type aliasWrapper struct {
+	Alias *ast.TypeSpec
+	//The wrapper as a spec type, with the structure of the type it wraps so generic types can match it
+	Spec *ast.TypeSpec
+}
+
+//The spec types that can implement generic types, with aliases resolved
+//Aliases that need a wrapper are left out when wrappers aren't enabled, see unwrappedAliases
+func (imp *Implementor) specCandidates() (candidates typeSet, unwrapped []aliasWrapper, errors []error) {
+	var provided typeSet = imp.TypeProvider.Types()
+	imp.wrappers = map[string]aliasWrapper{}
+
+	for _, t := range provided.Where(isInstantiable) {
+		if !t.Assign.IsValid() {
+			candidates = append(candidates, t)
+			continue
+		}
+
+		//The aliased spec type is a candidate itself
+		target, local := imp.aliased(t)
+		if local {
+			continue
+		}
+
+		name := wrapperName(t.Name.Name)
+		w := aliasWrapper{t, &ast.TypeSpec{Name: ast.NewIdent(name), Type: imp.structureOf(target)}}
+		if !imp.WrapAliases {
+			unwrapped = append(unwrapped, w)
+			continue
+		}
+		//A wrapper the spec package already declares is implemented like any other spec type
+		if existing, declared := imp.declaredWrapper(name); declared {
+			if existing.Assign.IsValid() || !EquivalentExprs(existing.Type, t.Type) {
+				errors = append(errors, fmt.Errorf("Cannot wrap alias %s, %s is already declared", t.Name.Name, name))
+			} else if !provided.Any(func(p *ast.TypeSpec) bool { return p == existing }) {
+				candidates = append(candidates, existing)
+			}
+			continue
+		}
+		imp.wrappers[name] = w
+		candidates = append(candidates, w.Spec)
+	}
+	return
+}
+
+//Warn about the aliases left out that would have implemented the primary generic type, had they been wrapped
+func (imp *Implementor) unwrappedAliases(cp ContextPair, unwrapped []aliasWrapper, primary *ast.TypeSpec) {
+	for _, w := range unwrapped {
+		if len(imp.Targets) != 0 && !imp.isTarget(w.Alias.Name.Name) {
+			continue
+		}
+		if ok, _, _ := Implement(cp, NewImplMap(), w.Spec, primary); ok {
+			warning := fmt.Sprintf("%s is an alias of %s, which can't have methods declared on it. Use --wrap-aliases to implement it with a wrapper type", w.Alias.Name.Name, ExprString(w.Alias.Type))
+			if !containsString(imp.warnings, warning) {
+				imp.warnings = append(imp.warnings, warning)
+			}
+		}
+	}
+}
+
+//The type an alias resolves to through any aliases of aliases, and whether it's a defined type of the spec package
+func (imp *Implementor) aliased(t *ast.TypeSpec) (target ast.Expr, local bool) {
+	seen := map[string]bool{}
+	for target = t.Type; ; {
+		id, ok := target.(*ast.Ident)
+		if !ok || seen[id.Name] {
+			return
+		}
+		seen[id.Name] = true
+
+		spec, declared := imp.TypeProvider.LookupType(id.Name)
+		if !declared {
+			return
+		}
+		if !spec.Assign.IsValid() {
+			return target, true
+		}
+		target = spec.Type
+	}
+}
+
+//The structure of a type of another package, with the types that package declares qualified by its import
+//Types that can't be found are matched by name alone
+func (imp *Implementor) structureOf(x ast.Expr) ast.Expr {
+	sel, ok := x.(*ast.SelectorExpr)
+	if !ok {
+		return x
+	}
+
+	r := newMethodResolver(imp.TypeProvider, imp.Dir)
+	pkg, from, err := r.importedPackage(imp.TypeProvider, sel)
+	if err != nil {
+		return x
+	}
+	spec, declared := pkg.LookupType(sel.Sel.Name)
+	if !declared || spec.TypeParams != nil {
+		return x
+	}
+	copied, ok := substituteIdents(spec.Type, nil)
+	if !ok {
+		return x
+	}
+	return qualifiedIn(copied, pkg, from)
+}
+
+//The spec type a candidate stands for, which for a wrapper is the alias it wraps
+func (imp *Implementor) specName(name string) string {
+	if w, wrapped := imp.wrappers[name]; wrapped {
+		return w.Alias.Name.Name
+	}
+	return name
+}
+
+//Whether a spec type was asked for, by its own name or by an alias of it
+func (imp *Implementor) isTarget(name string) bool {
+	for _, target := range imp.Targets {
+		if target == name {
+			return true
+		}
+		if t, declared := imp.TypeProvider.LookupType(target); declared && t.Assign.IsValid() {
+			if x, local := imp.aliased(t); local && ExprString(x) == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func wrapperName(alias string) string {
+	return alias + "Wrapper"
+}
+
+//The file a wrapper is declared in, shared by every generic that implements its alias
+func wrapperFileName(alias string) string {
+	return strings.ToLower(alias) + "_wrapper.go"
+}
+
+//A wrapper declared by the spec package itself, rather than generated into it
+//Under file scope sibling files aren't in scope, so they are searched as well
+func (imp *Implementor) declaredWrapper(name string) (t *ast.TypeSpec, declared bool) {
+	if t, declared = imp.TypeProvider.LookupType(name); declared || imp.TypeProvider.Package == nil {
+		return
+	}
+	generated := generatedIn(imp.Dir)
+	for path, file := range imp.TypeProvider.Package.Files {
+		if generated(filepath.Base(path)) {
+			continue
+		}
+		if obj := file.Scope.Lookup(name); obj != nil {
+			if t, declared = obj.Decl.(*ast.TypeSpec); declared {
+				return
+			}
+		}
+	}
+	return
+}
+
+//The files declaring the wrappers an implementation uses, one per wrapper
+//Every generic implementing an alias generates the same file, so it is only ever declared once
+func (imp *Implementor) wrapperSources(impls implSet) (sources SourceSet, errors []error) {
+	used := map[string]bool{}
+	for _, imap := range impls {
+		for _, x := range imap {
+			if id, ok := x.(*ast.Ident); ok {
+				if _, wrapped := imp.wrappers[id.Name]; wrapped {
+					used[id.Name] = true
+				}
+			}
+		}
+	}
+
+	names := []string{}
+	for name := range used {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		w := imp.wrappers[name]
+		alias := w.Alias.Name.Name
+		wrapped, _ := substituteIdents(w.Alias.Type, nil)
+
+		wrap, unwrap := "Wrap"+alias, "Unwrap"
+		if !ast.IsExported(alias) {
+			wrap, unwrap = "wrap"+strings.Title(alias), "unwrap"
+		}
+		convert := func(to, from string) *ast.BlockStmt {
+			return &ast.BlockStmt{List: []ast.Stmt{&ast.ReturnStmt{Results: []ast.Expr{
+				&ast.CallExpr{Fun: ast.NewIdent(to), Args: []ast.Expr{ast.NewIdent(from)}},
+			}}}}
+		}
+		field := func(name, typ string) *ast.FieldList {
+			f := &ast.Field{Type: ast.NewIdent(typ)}
+			if name != "" {
+				f.Names = []*ast.Ident{ast.NewIdent(name)}
+			}
+			return &ast.FieldList{List: []*ast.Field{f}}
+		}
+
+		ctx := &Context{
+			File:    &ast.File{Name: ast.NewIdent(imp.TypeProvider.File.Name.Name)},
+			FileSet: token.NewFileSet(),
+		}
+		ctx.File.Decls = []ast.Decl{
+			&ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{&ast.TypeSpec{Name: ast.NewIdent(name), Type: wrapped}}},
+			&ast.FuncDecl{
+				Name: ast.NewIdent(wrap),
+				Type: &ast.FuncType{Params: field("x", alias), Results: field("", name)},
+				Body: convert(name, "x"),
+			},
+			&ast.FuncDecl{
+				Recv: field("w", name),
+				Name: ast.NewIdent(unwrap),
+				Type: &ast.FuncType{Params: &ast.FieldList{}, Results: field("", alias)},
+				Body: convert(alias, "w"),
+			},
+		}
+		for _, spec := range imp.TypeProvider.ImportsOf(w.Alias.Type) {
+			ctx.AddImportFromSpec(spec)
+		}
+
+		if imp.Output != nil {
+			if errs := imp.relocate(ctx); len(errs) != 0 {
+				errors = append(errors, errs...)
+				continue
+			}
+		}
+		sources = append(sources, &SourceCode{ctx, wrapperFileName(alias)})
+	}
+	return
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const aliasGeneric = `package gen
+type T interface{}
+type Iter []T
+func (i Iter) Where(fn func(T) bool) Iter { return i }`
+
+func Test_Aliases(t *testing.T) {
+	const spec = "type Counts []int\ntype Nums = Counts\ntype Ints = []int\ntype strs = []string\n"
+
+	tests := []struct {
+		Wrap     bool
+		Targets  []string
+		Names    []string
+		Expect   []string
+		Warnings int
+	}{
+		{false, nil, []string{"Counts"}, []string{"func (i Counts) Where"}, 2},
+		{true, nil, []string{"Counts", "Ints", "strs", "ints_wrapper.go", "strs_wrapper.go"},
+			[]string{"type IntsWrapper []int", "func WrapInts(x Ints) IntsWrapper", "func (w IntsWrapper) Unwrap() Ints", "func (i IntsWrapper) Where(fn func(int) bool) IntsWrapper",
+				"type strsWrapper []string", "func wrapStrs(x strs) strsWrapper", "func (w strsWrapper) unwrap() strs"},
+			0},
+		{false, []string{"Nums"}, []string{"Counts"}, []string{"func (i Counts) Where"}, 0},
+		{true, []string{"Ints"}, []string{"Ints", "ints_wrapper.go"}, []string{"type IntsWrapper []int"}, 0},
+	}
+
+	for _, tst := range tests {
+		gen, _ := NewSourceStringContext(aliasGeneric, "gen.go")
+		provider, _ := NewSourceStringContext("package main\n"+spec, "spec.go")
+		imp := NewImplementor(provider)
+		imp.WrapAliases, imp.Targets = tst.Wrap, tst.Targets
+
+		codes, ok, errors := imp.Transform(gen)
+		if !ok {
+			t.Errorf("Expected an implementation of %v, found %v", tst.Names, errors)
+			continue
+		}
+
+		var b bytes.Buffer
+		names := []string{}
+		for _, code := range codes {
+			names = append(names, code.Name)
+			printer.Fprint(&b, token.NewFileSet(), code.File)
+		}
+		if strings.Join(names, " ") != strings.Join(tst.Names, " ") {
+			t.Errorf("Expected implementations of %v, found %v", tst.Names, names)
+		}
+
+		src := strings.Join(strings.Fields(b.String()), " ")
+		for _, expect := range tst.Expect {
+			if !strings.Contains(src, expect) {
+				t.Errorf("Expected %q in implementation:\n%s", expect, b.String())
+			}
+		}
+		if len(imp.warnings) != tst.Warnings {
+			t.Errorf("Expected %d warnings, found %v", tst.Warnings, imp.warnings)
+		}
+	}
+}
+
+func Test_AliasWrapperShared(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	writeTestFiles(dir, map[string]string{
+		"gen/iter.go":  aliasGeneric,
+		"gen/count.go": "package gen\ntype T interface{}\ntype Counter []T\nfunc (c Counter) Count() int { return len(c) }",
+		"app/main.go":  "package main\ntype Ints = []int\nfunc main() {}",
+	})
+
+	g := newGenerator(".", nil)
+	for i := 0; i < 2; i++ {
+		for _, generic := range []string{"iter.go", "count.go"} {
+			job := generateJob{Generic: filepath.Join(dir, "gen", generic), Spec: filepath.Join(dir, "app", "main.go"), WrapAliases: true, Directive: generateDirective}
+			if errors := g.Run(job); len(errors) != 0 {
+				t.Fatal(errors)
+			}
+		}
+	}
+
+	if err := typeCheckDir(filepath.Join(dir, "app")); err != nil {
+		t.Errorf("Expected generics sharing a wrapper to compile, found %s", err)
+	}
+
+	m, _ := loadManifest(filepath.Join(dir, "app"))
+	for _, entry := range m.Entries {
+		if !containsString(entry.Files, "ints_wrapper.go") {
+			t.Errorf("Expected every job using the wrapper to record it, found %v", entry.Files)
+		}
+	}
+
+	//A wrapper the package declares itself is implemented rather than generated
+	os.Remove(filepath.Join(dir, "app", "ints_wrapper.go"))
+	writeTestFiles(dir, map[string]string{"app/wrapper.go": "package main\ntype IntsWrapper []int"})
+	job := generateJob{Generic: filepath.Join(dir, "gen", "iter.go"), Spec: filepath.Join(dir, "app", "main.go"), WrapAliases: true, Directive: generateDirective}
+	if errors := newGenerator(".", nil).Run(job); len(errors) != 0 {
+		t.Fatal(errors)
+	}
+	if fileExists(filepath.Join(dir, "app", "ints_wrapper.go")) {
+		t.Error("Expected a declared wrapper not to be generated again")
+	}
+	if err := typeCheckDir(filepath.Join(dir, "app")); err != nil {
+		t.Errorf("Expected the declared wrapper to be implemented, found %s", err)
+	}
+}
+
+//Type check the package in a directory, which can only import the standard library
+func typeCheckDir(dir string) error {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, nil, 0)
+	if err != nil {
+		return err
+	}
+	for _, pkg := range pkgs {
+		files := []*ast.File{}
+		for _, file := range pkg.Files {
+			files = append(files, file)
+		}
+		conf := types.Config{Importer: importer.Default()}
+		if _, err := conf.Check(pkg.Name, fset, files, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//Annotates a single spec type for implementation, instead of every type in a file like go:generate does
+//	//goast:impl goast.net/x/iter prefix=gen_
+//	type Ints []int
+//The generic comes first, followed by options. prefix, suffix, out, package, form, receivers and wrap-aliases are the same as in a generate job,
+//any other Name=Type option binds generic type Name to Type
+const implAnnotation = "//goast:impl"
+
+const annotationDirective = "annotation"
+
+//Parse the options of an annotation into a job for the annotated type
+func parseImplAnnotation(text, specFile, typeName string) (job generateJob, err error) {
+	fields := strings.Fields(strings.TrimPrefix(text, implAnnotation))
+	if len(fields) == 0 {
+		err = fmt.Errorf("%s: annotation of %s has no generic", specFile, typeName)
+		return
+	}
+
+	job = generateJob{Generic: fields[0], Spec: specFile, Types: []string{typeName}, Directive: annotationDirective}
+
+	//Like go:generate directives, generic files are relative to the annotated package
+	if strings.HasSuffix(job.Generic, ".go") && !filepath.IsAbs(job.Generic) {
+		job.Generic = filepath.Join(filepath.Dir(specFile), job.Generic)
+	}
+	for _, option := range fields[1:] {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) != 2 {
+			err = fmt.Errorf("%s: invalid option %s in annotation of %s, expected name=value", specFile, option, typeName)
+			return
+		}
+
+		switch parts[0] {
+		case "prefix":
+			job.Prefix = parts[1]
+		case "suffix":
+			job.Suffix = parts[1]
+		case "out":
+			job.Out = filepath.Join(filepath.Dir(specFile), parts[1])
+		case "package":
+			job.Package = parts[1]
+		case "form":
+			job.Form = parts[1]
+		case "single-file":
+			job.SingleFile = parts[1]
+		case "spec-scope":
+			job.SpecScope = parts[1]
+		case "receivers":
+			job.Receivers = parts[1]
+		case "wrap-aliases":
+			job.WrapAliases = parts[1] == "true"
+		default:
+			if job.Bindings == nil {
+				job.Bindings = map[string]string{}
+			}
+			job.Bindings[parts[0]] = parts[1]
+		}
+	}
+	return
+}
+
+//The annotations of every type declared in a file
+func annotatedJobs(file *ast.File, specFile string) (jobs []generateJob, errors []error) {
+	for _, decl := range file.Decls {
+		g, ok := decl.(*ast.GenDecl)
+		if !ok || g.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range g.Specs {
+			t := spec.(*ast.TypeSpec)
+
+			//A lone type declaration keeps its comments on the GenDecl, grouped declarations on each TypeSpec
+			doc := t.Doc
+			if doc == nil && len(g.Specs) == 1 {
+				doc = g.Doc
+			}
+			if doc == nil {
+				continue
+			}
+
+			for _, c := range doc.List {
+				if !strings.HasPrefix(c.Text, implAnnotation+" ") {
+					continue
+				}
+				if job, err := parseImplAnnotation(c.Text, specFile, t.Name.Name); err == nil {
+					jobs = append(jobs, job)
+				} else {
+					errors = append(errors, err)
+				}
+			}
+		}
+	}
+	return
+}
+
+//Annotated types that share a spec file, generic and options are implemented by one job
+func mergeJobs(jobs []generateJob) (merged []generateJob) {
+	index := map[string]int{}
+	for _, job := range jobs {
+		key := fmt.Sprintf("%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|%t|%v", job.Spec, job.Generic, job.Prefix, job.Suffix, job.Out, job.Package, job.Form, job.SingleFile, job.SpecScope, job.Receivers, job.WrapAliases, job.Bindings)
+		if i, found := index[key]; found {
+			merged[i].Types = append(merged[i].Types, job.Types...)
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, job)
+	}
+	return
+}
+
+//Find the jobs annotated in a package directory, or in every package beneath it for patterns like ./...
+func discoverJobs(pattern string) (jobs []generateJob, errors []error) {
+	jobs, errors = discover(pattern, annotatedJobs)
+	jobs = mergeJobs(jobs)
+	return
+}
+
+//Find jobs in every file of the packages matched by a pattern
+func discover(pattern string, find func(*ast.File, string) ([]generateJob, []error)) (jobs []generateJob, errors []error) {
+	for _, dir := range patternDirs(pattern) {
+		fset := token.NewFileSet()
+		built := func(fi os.FileInfo) bool { return isBuiltFile(dir, fi) }
+		pkgs, err := parser.ParseDir(fset, dir, built, parser.ParseComments)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+
+		for _, pkg := range pkgs {
+			names := []string{}
+			for name := range pkg.Files {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				found, errs := find(pkg.Files[name], name)
+				jobs = append(jobs, found...)
+				errors = append(errors, errs...)
+			}
+		}
+	}
+	return
+}
+
+//The package directories matched by a pattern, either a single directory or every package beneath one like ./...
+func patternDirs(pattern string) []string {
+	if strings.HasSuffix(pattern, "...") {
+		return packageDirs(filepath.Clean(strings.TrimSuffix(pattern, "...")))
+	}
+	return []string{pattern}
+}
+
+//Every directory beneath root that the go tool would treat as a package
+func packageDirs(root string) (dirs []string) {
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+
+		name := info.Name()
+		if path != root && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+			return filepath.SkipDir
+		}
+
+		if matches, _ := filepath.Glob(filepath.Join(path, "*.go")); len(matches) != 0 {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_AnnotatedJobs(t *testing.T) {
+	src := `package main
+
+//goast:impl goast.net/x/iter prefix=gen_
+type Ints []int
+
+type Names []string
+
+type (
+	//goast:impl goast.net/x/iter prefix=gen_
+	Floats []float64
+	//goast:impl goast.net/x/sort T=*User out=sorted
+	Users []*User
+)`
+	file, _ := parser.ParseFile(token.NewFileSet(), "app/main.go", src, parser.ParseComments)
+	jobs, errors := annotatedJobs(file, "app/main.go")
+	if len(errors) != 0 {
+		t.Fatal(errors)
+	}
+
+	expect := []generateJob{
+		{Generic: "goast.net/x/iter", Spec: "app/main.go", Types: []string{"Ints", "Floats"}, Prefix: "gen_", Directive: annotationDirective},
+		{Generic: "goast.net/x/sort", Spec: "app/main.go", Types: []string{"Users"}, Bindings: map[string]string{"T": "*User"}, Out: filepath.Join("app", "sorted"), Directive: annotationDirective},
+	}
+	if jobs = mergeJobs(jobs); !reflect.DeepEqual(jobs, expect) {
+		t.Errorf("Expected jobs %+v, found %+v", expect, jobs)
+	}
+
+	if _, err := parseImplAnnotation("//goast:impl goast.net/x/iter gen_", "main.go", "Ints"); err == nil {
+		t.Error("Expected options without a value to be invalid")
+	}
+}
+
+func Test_GenerateAnnotations(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "app", "users"), 0755)
+	genFile := filepath.Join(dir, "slice.go")
+	ioutil.WriteFile(genFile, []byte(`package gen
+type T interface{}
+type Slice []T
+func (s Slice) First() T { return s[0] }`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "app", "users", "users.go"), []byte(`package users
+
+//goast:impl `+genFile+`
+type Ints []int
+
+type Names []string`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "app", "users", "tools.go"), []byte(`//go:build ignore
+
+package users
+
+//goast:impl `+genFile+`
+type Tools []string`), 0644)
+
+	generate(filepath.Join(dir, "app")+"/...", nil)
+
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "app", "users", "ints_slice.go")); err != nil || !strings.Contains(string(b), "func (s Ints) First() int") {
+		t.Errorf("Expected the annotated type to be implemented, found %q %v", b, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "app", "users", "names_slice.go")); err == nil {
+		t.Error("Expected types without annotations not to be implemented")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "app", "users", "tools_slice.go")); err == nil {
+		t.Error("Expected annotations in files that aren't built to be ignored")
+	}
+}
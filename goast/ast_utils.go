@@ -34,7 +34,15 @@ func declAsTypeSpec(d ast.Decl) (t *ast.TypeSpec, ok bool) {
 	return
 }
 
+//Key that anonymous empty interfaces are stored under in an ImplMap
+//Every anonymous interface{} or any in a generic file is the same implicit type parameter
+const emptyInterface = "interface{}"
+
 func isEmptyInterface(node ast.Node) bool {
+	if id, ok := node.(*ast.Ident); ok {
+		return isAnyIdent(id)
+	}
+
 	i, ok := node.(*ast.InterfaceType)
 	if !ok {
 		return false
@@ -44,6 +52,11 @@ func isEmptyInterface(node ast.Node) bool {
 	return isEmpty
 }
 
+//The predeclared any, as long as the file hasn't declared something else by that name
+func isAnyIdent(id *ast.Ident) bool {
+	return id.Name == "any" && id.Obj == nil
+}
+
 func EquivalentExprs(a, b ast.Expr) bool {
 	// *Ident, *ParenExpr, *SelectorExpr, *StarExpr, or any of the *XxxTypes
 	switch aType := a.(type) {
@@ -52,6 +65,26 @@ func EquivalentExprs(a, b ast.Expr) bool {
 			return aType.Name == bType.Name
 		}
 
+	case *ast.BasicLit:
+		if bType, ok := b.(*ast.BasicLit); ok {
+			return aType.Kind == bType.Kind && aType.Value == bType.Value
+		}
+
+	case *ast.SelectorExpr:
+		if bType, ok := b.(*ast.SelectorExpr); ok {
+			return aType.Sel.Name == bType.Sel.Name && EquivalentExprs(aType.X, bType.X)
+		}
+
+	case *ast.IndexExpr:
+		if bType, ok := b.(*ast.IndexExpr); ok {
+			return EquivalentExprs(aType.X, bType.X) && EquivalentExprs(aType.Index, bType.Index)
+		}
+
+	case *ast.IndexListExpr:
+		if bType, ok := b.(*ast.IndexListExpr); ok {
+			return EquivalentExprs(aType.X, bType.X) && equivalentExprList(aType.Indices, bType.Indices)
+		}
+
 	case *ast.StarExpr:
 		if bType, ok := b.(*ast.StarExpr); ok {
 			return EquivalentExprs(aType.X, bType.X)
@@ -59,7 +92,7 @@ func EquivalentExprs(a, b ast.Expr) bool {
 
 	case *ast.ArrayType:
 		if bType, ok := b.(*ast.ArrayType); ok {
-			return EquivalentExprs(aType.Elt, bType.Elt)
+			return equivalentArrayLen(aType.Len, bType.Len) && EquivalentExprs(aType.Elt, bType.Elt)
 		}
 
 	case *ast.ChanType:
@@ -84,12 +117,34 @@ func EquivalentExprs(a, b ast.Expr) bool {
 
 	case *ast.StructType:
 		if bType, ok := b.(*ast.StructType); ok {
-			return equivalentFieldList(aType.Fields, bType.Fields)
+			return equivalentFieldList(aType.Fields, bType.Fields) && equivalentFieldNames(aType.Fields, bType.Fields)
 		}
 	}
 	return false
 }
 
+func equivalentExprList(a, b []ast.Expr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !EquivalentExprs(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+//Slices have no length, so two lengths are only equivalent if both are missing or both match
+func equivalentArrayLen(a, b ast.Expr) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return EquivalentExprs(a, b)
+}
+
+//Fields are compared one by one, so a, b int is the same as a int; b int and int, int
 func equivalentFieldList(a, b *ast.FieldList) bool {
 	if a == nil && b == nil {
 		return true
@@ -99,16 +154,58 @@ func equivalentFieldList(a, b *ast.FieldList) bool {
 		return false
 	}
 
-	if len(a.List) != len(b.List) {
+	aTypes, bTypes := fieldTypes(a), fieldTypes(b)
+	if len(aTypes) != len(bTypes) {
 		return false
 	}
 
-	for i, aField := range a.List {
-		bField := b.List[i]
-		if EquivalentExprs(aField.Type, bField.Type) {
+	for i := range aTypes {
+		if !EquivalentExprs(aTypes[i], bTypes[i]) {
 			return false
 		}
 	}
 
 	return true
 }
+
+//The type of each field in a list, repeated for each name a field declares
+func fieldTypes(list *ast.FieldList) (types []ast.Expr) {
+	for _, field := range list.List {
+		for k := 0; k < len(field.Names) || k == 0; k++ {
+			types = append(types, field.Type)
+		}
+	}
+	return
+}
+
+//Struct fields are only the same if they're selected by the same names, and an embedded field
+//is a different field than one that's named after its type
+func equivalentFieldNames(a, b *ast.FieldList) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	aNames, bNames := structFieldNames(a), structFieldNames(b)
+	if len(aNames) != len(bNames) {
+		return false
+	}
+	for i := range aNames {
+		if aNames[i] != bNames[i] {
+			return false
+		}
+	}
+	return true
+}
+
+//The name of each field in a struct, with embedded fields marked as such
+func structFieldNames(list *ast.FieldList) (names []string) {
+	for _, field := range list.List {
+		for _, name := range fieldNames(field) {
+			if len(field.Names) == 0 {
+				name = "embedded " + name
+			}
+			names = append(names, name)
+		}
+	}
+	return
+}
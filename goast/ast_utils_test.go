@@ -0,0 +1,52 @@
+package main
+
+import (
+	"go/parser"
+	"testing"
+)
+
+func Test_EquivalentExprs(t *testing.T) {
+	tests := []struct {
+		A, B   string
+		Expect bool
+	}{
+		{"[]int", "[]int", true},
+		{"[]int", "[4]int", false},
+		//Fields and parameters of the same types are equivalent, and of different types aren't
+		{"func(int) string", "func(int) string", true},
+		{"func(int) string", "func(string) string", false},
+		{"struct{ A int }", "struct{ A int }", true},
+		{"struct{ A int }", "struct{ A string }", false},
+		//Struct fields are selected by name, so the same types with other names are different structs
+		{"struct{ A int }", "struct{ B int }", false},
+		{"struct{ A, B int }", "struct{ A, C int }", false},
+		//Embedded fields aren't the same as fields named after their type
+		{"struct{ T }", "struct{ T T }", false},
+		{"struct{ T }", "struct{ T }", true},
+		{"struct{ *T }", "struct{ U *T }", false},
+		//Parameter names don't matter
+		{"func(a int)", "func(b int)", true},
+		//Grouped names declare a field each
+		{"func(a, b int)", "func(int, int)", true},
+		{"func(a, b int)", "func(a int, b int)", true},
+		{"func(a, b int)", "func(int)", false},
+		{"func() (x, y string)", "func() (string, string)", true},
+		{"struct{ A, B int }", "struct{ A int; B int }", true},
+		{"struct{ A, B int }", "struct{ A int; B string }", false},
+		{"struct{ A, B int }", "struct{ B, A int }", false},
+	}
+
+	for _, tst := range tests {
+		a, err := parser.ParseExpr(tst.A)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := parser.ParseExpr(tst.B)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if EquivalentExprs(a, b) != tst.Expect {
+			t.Errorf("Expected %s and %s equivalent to be %t", tst.A, tst.B, tst.Expect)
+		}
+	}
+}
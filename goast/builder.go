@@ -0,0 +1,103 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+//Generates a fluent builder for each spec struct, with a method to set each field and a Build method, e.g. for
+//	type Config struct{ Name string; timeout time.Duration }
+//	NewConfigBuilder().Name("api").Timeout(time.Second).Build()
+//Build returns a pointer when the struct's methods have pointer receivers, and a copy of the struct otherwise
+type Builder struct {
+	fieldSelection
+}
+
+func NewBuilder(pkg *Context, types, include, exclude []string) *Builder {
+	return &Builder{fieldSelection{pkg, types, include, exclude}}
+}
+
+//The names of the builder type of a struct and its constructor, exported only if the struct is
+func builderNames(name string) (builder, constructor string) {
+	if ast.IsExported(name) {
+		return name + "Builder", "New" + name + "Builder"
+	}
+	return name + "Builder", "new" + strings.Title(name) + "Builder"
+}
+
+func (b *Builder) Transform(spec *Context) (codes SourceSet, ok bool, errors []error) {
+	names, structs := b.structs(spec)
+	for i, name := range names {
+		var (
+			builder, constructor = builderNames(name)
+			_, pointer           = receiverOf(b.Package, name)
+			imports              ImportSpecs
+			decls                bytes.Buffer
+		)
+
+		fmt.Fprintf(&decls, "\ntype %s struct {\n\tbuilt %s\n}\n", builder, name)
+		fmt.Fprintf(&decls, "\nfunc %s() *%s {\n\treturn &%s{}\n}\n", constructor, builder, builder)
+
+		//Fields such as x and X would both be set by X
+		setters := map[string]string{"Build": "Build"}
+		for _, f := range b.fields(structs[i]) {
+			method := callFieldName(f.Name)
+			if clash, found := setters[method]; found {
+				errors = append(errors, fmt.Errorf("Cannot generate a builder method for %s.%s, it would clash with %s", name, f.Name, clash))
+				continue
+			}
+			setters[method] = "the method for " + f.Name
+
+			param := paramName(f.Name, "b")
+			fmt.Fprintf(&decls, "\nfunc (b *%s) %s(%s %s) *%s {\n\tb.built.%s = %s\n\treturn b\n}\n", builder, method, param, ExprString(f.Type), builder, f.Name, param)
+			imports = append(imports, b.Package.SelectedImports(f.Type)...)
+		}
+
+		if pointer {
+			fmt.Fprintf(&decls, "\nfunc (b *%s) Build() *%s {\n\tbuilt := b.built\n\treturn &built\n}\n", builder, name)
+		} else {
+			fmt.Fprintf(&decls, "\nfunc (b *%s) Build() %s {\n\treturn b.built\n}\n", builder, name)
+		}
+
+		source, err := generatedSource(b.Package, name, imports, decls.Bytes())
+		if err != nil {
+			errors = append(errors, fmt.Errorf("Cannot generate the builder of %s: %s", name, err))
+			continue
+		}
+		codes = append(codes, source)
+	}
+
+	if len(codes) == 0 && len(errors) == 0 {
+		errors = append(errors, fmt.Errorf("No struct in %s to generate a builder for", spec.File.Name.Name))
+	}
+	ok = len(errors) == 0
+	return
+}
+
+//Generate builders for the structs of a spec file, written next to it
+func builders(specFile string, types, include, exclude []string, cfg writeConfig) {
+	fmt.Printf("Builder %s\n", specFile)
+	cfg.Types = types
+	transformSpec(specFile, "builder.go", cfg, func(pkg *Context, dir string) AstTransform {
+		return NewBuilder(pkg, types, include, exclude)
+	})
+}
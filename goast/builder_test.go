@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_Builder(t *testing.T) {
+	sources := transformedSource(t, accessorsSpec, func(pkg *Context, dir string) AstTransform {
+		return NewBuilder(pkg, nil, nil, []string{"retries"})
+	})
+
+	tests := []struct {
+		Name           string
+		Expect, Reject []string
+	}{
+		{"Config", []string{
+			"type ConfigBuilder struct {\n\tbuilt Config\n}",
+			"func NewConfigBuilder() *ConfigBuilder {",
+			"func (b *ConfigBuilder) Timeout(timeout time.Duration) *ConfigBuilder {\n\tb.built.timeout = timeout\n\treturn b\n}",
+			"func (b *ConfigBuilder) Meta(meta *Meta) *ConfigBuilder {",
+			"func (b *ConfigBuilder) Id(id int) *ConfigBuilder {",
+			"func (b *ConfigBuilder) Build() *Config {",
+		}, []string{"Retries(", "Tags("}},
+		{"point", []string{
+			"type pointBuilder struct",
+			"func newPointBuilder() *pointBuilder {",
+			"func (b *pointBuilder) Build() point {\n\treturn b.built\n}",
+		}, nil},
+	}
+
+	for _, tst := range tests {
+		src, found := sources[tst.Name]
+		if !found {
+			t.Errorf("Expected a builder for %s, found %v", tst.Name, sources)
+			continue
+		}
+		for _, expect := range tst.Expect {
+			if !strings.Contains(src, expect) {
+				t.Errorf("Expected the builder of %s to contain\n%s\nfound\n%s", tst.Name, expect, src)
+			}
+		}
+		for _, reject := range tst.Reject {
+			if strings.Contains(src, reject) {
+				t.Errorf("Expected the builder of %s not to contain %s, found\n%s", tst.Name, reject, src)
+			}
+		}
+	}
+}
+
+func Test_BuilderClashes(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+	writeTestFiles(dir, map[string]string{"app/app.go": "package app\n\ntype Point struct {\n\tx, X  int\n\tBuild bool\n}\n"})
+	specFile := filepath.Join(dir, "app", "app.go")
+
+	spec, _ := NewFileContext(specFile)
+	pkg, _ := NewPackageContext(specFile, func(string) bool { return false })
+	_, ok, errors := NewBuilder(pkg, nil, nil, nil).Transform(spec)
+	if ok || len(errors) != 2 {
+		t.Fatalf("Expected an error for each field whose setter clashes, found %v", errors)
+	}
+	for i, expect := range []string{"Point.X, it would clash with the method for x", "Point.Build, it would clash with Build"} {
+		if !strings.Contains(errors[i].Error(), expect) {
+			t.Errorf("Expected an error containing %q, found %s", expect, errors[i])
+		}
+	}
+}
@@ -0,0 +1,245 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+//An on-disk cache of generated source, so unchanged generics aren't solved and rewritten on every go generate
+//Entries are keyed on everything that affects the output: the goast version, the write flags,
+//the generic source, the spec file and the spec package's type declarations
+type generationCache struct {
+	Dir     string
+	Verbose bool
+}
+
+//A generated file as it is stored in the cache
+type cachedSource struct {
+	Name   string
+	Source []byte
+}
+
+//The cache lives under $XDG_CACHE_HOME/goast, or the platform's equivalent
+//Returns nil when there is nowhere to keep it, which disables caching
+func openGenerationCache(verbose bool) *generationCache {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil
+	}
+	return &generationCache{filepath.Join(dir, "goast"), verbose}
+}
+
+func (c *generationCache) logf(format string, args ...interface{}) {
+	if c.Verbose {
+		fmt.Printf(format, args...)
+	}
+}
+
+//Hash everything that the implementation of a generic source file depends on
+//Only type declarations and imports of the spec package are included, so editing function bodies doesn't invalidate entries,
+//along with the receivers of its methods when generated receivers match them
+//The spec file is given relative to the output directory, as spec files of one package share everything else
+func generationKey(genericSourceFile, specFile string, spec *Context, cfg writeConfig) (key string, err error) {
+	src, err := ioutil.ReadFile(genericSourceFile)
+	if err != nil {
+		return
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "goast %s\nprefix %q suffix %q\n", VERSION, cfg.Prefix, cfg.Suffix)
+	names := []string{}
+	for name := range cfg.Bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "bind %s %s\n", name, cfg.Bindings[name])
+	}
+	fmt.Fprintf(h, "types %q scope %q\npackage %q form %q receivers %q wrap %t\n", cfg.Types, cfg.SpecScope, cfg.Package, cfg.Form, cfg.Receivers, cfg.WrapAliases)
+	fmt.Fprintf(h, "generic %s %d\n", filepath.Base(genericSourceFile), len(src))
+	h.Write(src)
+	fmt.Fprintf(h, "spec %s\n", specFile)
+	writeSpecDecls(h, spec)
+
+	//Under file scope only the spec file's own types are implemented, the rest of the package just resolves them
+	if spec.Package != nil && cfg.SpecScope != packageScope {
+		fmt.Fprintln(h, "spec types")
+		writeTypeDecls(h, spec.FileSet, spec.File)
+	}
+
+	//Matched receivers follow the receivers of the spec types' own methods, see receiverKindsOf
+	if cfg.Receivers == matchReceivers {
+		writeReceiverKinds(h, spec)
+	}
+
+	key = hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+//Write the declarations of a spec package that can affect an implementation, in a stable order
+func writeSpecDecls(w io.Writer, spec *Context) {
+	fmt.Fprintf(w, "package %s\n", spec.File.Name.Name)
+	for _, i := range spec.File.Imports {
+		printer.Fprint(w, token.NewFileSet(), i)
+		fmt.Fprintln(w)
+	}
+
+	for _, file := range specFiles(spec) {
+		writeTypeDecls(w, spec.FileSet, file)
+	}
+}
+
+//The files of a spec package, or just the spec file, in a stable order
+func specFiles(spec *Context) []*ast.File {
+	if spec.Package == nil {
+		return []*ast.File{spec.File}
+	}
+
+	names := []string{}
+	for name := range spec.Package.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	files := []*ast.File{}
+	for _, name := range names {
+		files = append(files, spec.Package.Files[name])
+	}
+	return files
+}
+
+//Write whether each type of a spec package has methods with pointer and with value receivers
+func writeReceiverKinds(w io.Writer, spec *Context) {
+	kinds := map[string][2]bool{}
+	for _, file := range specFiles(spec) {
+		for _, decl := range file.Decls {
+			f, isFunc := decl.(*ast.FuncDecl)
+			if !isFunc {
+				continue
+			}
+			if name, ok := methodRecieverTypeIdentifier(f); ok {
+				k := kinds[name]
+				if isPointer(f.Recv.List[0].Type) {
+					k[0] = true
+				} else {
+					k[1] = true
+				}
+				kinds[name] = k
+			}
+		}
+	}
+
+	names := []string{}
+	for name := range kinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "receivers %s pointer %t value %t\n", name, kinds[name][0], kinds[name][1])
+	}
+}
+
+func writeTypeDecls(w io.Writer, fset *token.FileSet, file *ast.File) {
+	for _, decl := range file.Decls {
+		if g, ok := decl.(*ast.GenDecl); ok && g.Tok == token.TYPE {
+			printer.Fprint(w, fset, g)
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+func (c *generationCache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key+".json")
+}
+
+//Load the generated files for a key, if they have been cached
+func (c *generationCache) Load(key string) (sources []cachedSource, ok bool) {
+	b, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return
+	}
+	ok = json.Unmarshal(b, &sources) == nil
+	return
+}
+
+func (c *generationCache) Store(key string, sources []cachedSource) error {
+	b, err := json.Marshal(sources)
+	if err != nil {
+		return err
+	}
+
+	path := c.path(key)
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	//Write to a temporary file first, so concurrent go generate runs never see a partial entry
+	tmp, err := ioutil.TempFile(filepath.Dir(path), key)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+//The cached implementation of a generic source file, without writing it anywhere
+func (c *generationCache) Lookup(genericSourceFile, specFile string, spec *Context, cfg writeConfig) (key string, sources []cachedSource, hit bool) {
+	key, err := generationKey(genericSourceFile, specFile, spec, cfg)
+	if err != nil {
+		c.logf("Cache disabled for %s: %s\n", genericSourceFile, err)
+		return
+	}
+
+	if sources, hit = c.Load(key); !hit {
+		c.logf("Cache miss for %s (%s)\n", genericSourceFile, key[:12])
+		return
+	}
+
+	c.logf("Cache hit for %s (%s)\n", genericSourceFile, key[:12])
+	return
+}
+
+//Printed source of generated code, ready to be written out or cached
+func cachedSourcesOf(codes SourceSet) (sources []cachedSource) {
+	for _, code := range codes {
+		var b bytes.Buffer
+		printer.Fprint(&b, token.NewFileSet(), code.File)
+		sources = append(sources, cachedSource{code.Name, b.Bytes()})
+	}
+	return
+}
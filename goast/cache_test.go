@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_GenerationCacheKey(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	genFile := filepath.Join(dir, "slice.go")
+	ioutil.WriteFile(genFile, []byte("package gen\ntype T interface{}\ntype Slice []T"), 0644)
+
+	keyOf := func(spec string, cfg writeConfig) string {
+		ctx, _ := NewSourceStringContext(spec, "spec.go")
+		key, err := generationKey(genFile, "spec.go", ctx, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	spec := "package main\ntype Ints []int\nfunc main() {}"
+	key := keyOf(spec, writeConfig{})
+
+	if keyOf("package main\ntype Ints []int\nfunc main() { println() }", writeConfig{}) != key {
+		t.Error("Expected function bodies in the spec not to change the key")
+	}
+
+	if keyOf("package main\ntype Ints []int64\nfunc main() {}", writeConfig{}) == key {
+		t.Error("Expected spec type declarations to change the key")
+	}
+
+	if keyOf(spec, writeConfig{Prefix: "goast_"}) == key {
+		t.Error("Expected flags to change the key")
+	}
+
+	//Matched receivers depend on the receivers of the spec type's methods, which are otherwise left out
+	match := writeConfig{Receivers: matchReceivers}
+	pointerRecv := "package main\ntype Ints []int\nfunc (s *Ints) Len() int { return len(*s) }"
+	valueRecv := "package main\ntype Ints []int\nfunc (s Ints) Len() int { return len(s) }"
+	if keyOf(pointerRecv, match) == keyOf(valueRecv, match) {
+		t.Error("Expected the receivers of spec methods to change the key when receivers are matched")
+	}
+	if keyOf(pointerRecv, writeConfig{}) != keyOf(valueRecv, writeConfig{}) {
+		t.Error("Expected the receivers of spec methods not to change the key otherwise")
+	}
+
+	ioutil.WriteFile(genFile, []byte("package gen\ntype T interface{}\ntype List []T"), 0644)
+	if keyOf(spec, writeConfig{}) == key {
+		t.Error("Expected the generic source to change the key")
+	}
+}
+
+func Test_GenerationCacheKeySpecFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	writeTestFiles(dir, map[string]string{
+		"gen/slice.go": manifestGeneric,
+		"app/ints.go":  "package main\n//go:generate goast write impl ../gen/slice.go\ntype Ints []int",
+		"app/names.go": "package main\n//go:generate goast write impl ../gen/slice.go\ntype Names []string",
+	})
+
+	cache := &generationCache{Dir: filepath.Join(dir, "cache")}
+	g := newGenerator(".", cache)
+	for _, spec := range []string{"ints.go", "names.go"} {
+		job := generateJob{Generic: filepath.Join(dir, "gen", "slice.go"), Spec: filepath.Join(dir, "app", spec), Directive: generateDirective}
+		if errors := g.Run(job); len(errors) != 0 {
+			t.Fatal(errors)
+		}
+	}
+
+	//Both spec files see the same package, so only the spec file tells their entries apart
+	if !fileExists(filepath.Join(dir, "app", "names_slice.go")) {
+		t.Error("Expected the second spec file of a package to be implemented rather than restored from the first")
+	}
+
+	spec, err := NewFilePackageContext(filepath.Join(dir, "app", "ints.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	genFile := filepath.Join(dir, "gen", "slice.go")
+	ints, _ := generationKey(genFile, "ints.go", spec, writeConfig{})
+	names, _ := generationKey(genFile, "names.go", spec, writeConfig{})
+	if ints == names {
+		t.Error("Expected spec files of the same package to have different keys")
+	}
+}
+
+func Test_GenerationCacheLookup(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	genFile := filepath.Join(dir, "slice.go")
+	ioutil.WriteFile(genFile, []byte("package gen\ntype T interface{}\ntype Slice []T"), 0644)
+	spec, _ := NewSourceStringContext("package main\ntype Ints []int", "spec.go")
+
+	cache := &generationCache{Dir: filepath.Join(dir, "cache")}
+	key, _, hit := cache.Lookup(genFile, "spec.go", spec, writeConfig{})
+	if hit || key == "" {
+		t.Fatalf("Expected a cache miss with a key, found hit %v key %q", hit, key)
+	}
+
+	if err := cache.Store(key, []cachedSource{{"ints_slice.go", []byte("package main\n")}}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, sources, hit := cache.Lookup(genFile, "spec.go", spec, writeConfig{})
+	if !hit || len(sources) != 1 || sources[0].Name != "ints_slice.go" || string(sources[0].Source) != "package main\n" {
+		t.Errorf("Expected a cache hit with ints_slice.go after storing, found %v", sources)
+	}
+}
@@ -0,0 +1,304 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//The jobs of every go:generate directive that runs goast write impl in a file
+//	//go:generate goast write impl --prefix=gen_ goast.net/x/iter
+func generateDirectiveJobs(file *ast.File, specFile string) (jobs []generateJob, errors []error) {
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			args := strings.Fields(strings.TrimPrefix(c.Text, "//go:generate"))
+			if !strings.HasPrefix(c.Text, "//go:generate") || len(args) == 0 || args[0] != "goast" {
+				continue
+			}
+			if args = skipGlobalFlags(args[1:]); len(args) < 2 || args[0] != "write" || args[1] != "impl" {
+				continue
+			}
+
+			if job, err := parseWriteImplArgs(args[2:], specFile); err == nil {
+				jobs = append(jobs, job)
+			} else {
+				errors = append(errors, err)
+			}
+		}
+	}
+	return
+}
+
+//Parse the arguments of goast write impl the way go generate would run them from the spec file's package
+func parseWriteImplArgs(args []string, specFile string) (job generateJob, err error) {
+	var (
+		dir        = filepath.Dir(specFile)
+		positional []string
+	)
+
+	job.Directive = generateDirective
+	for i := 0; i < len(args); i++ {
+		arg := os.Expand(args[i], func(name string) string {
+			if name == "GOFILE" {
+				return filepath.Base(specFile)
+			}
+			return os.Getenv(name)
+		})
+
+		if !strings.HasPrefix(arg, "-") {
+			positional = append(positional, arg)
+			continue
+		}
+
+		//Global flags such as --tags may also be given after the command
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		switch {
+		case containsString([]string{"prefix", "suffix", "out-dir", "package", "form", "single-file", "spec-scope", "receivers"}, name),
+			containsString(globalValueFlags, name):
+			if !hasValue && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+		}
+
+		switch name {
+		case "prefix":
+			job.Prefix = value
+		case "suffix":
+			job.Suffix = value
+		case "out-dir":
+			job.Out = filepath.Join(dir, value)
+		case "package":
+			job.Package = value
+		case "form":
+			job.Form = value
+		case "single-file":
+			job.SingleFile = value
+		case "spec-scope":
+			job.SpecScope = value
+		case "receivers":
+			job.Receivers = value
+		case "wrap-aliases":
+			job.WrapAliases = !hasValue || value == "true"
+		}
+	}
+
+	switch len(positional) {
+	case 1:
+		job.Generic, job.Spec = positional[0], specFile
+	case 2:
+		job.Generic, job.Spec = positional[0], filepath.Join(dir, positional[1])
+	default:
+		err = fmt.Errorf("%s: cannot parse go:generate goast write impl %s", specFile, strings.Join(args, " "))
+		return
+	}
+
+	if strings.HasSuffix(job.Generic, ".go") && !filepath.IsAbs(job.Generic) {
+		job.Generic = filepath.Join(dir, job.Generic)
+	}
+	return
+}
+
+//Delete generated files that no directive produces anymore, because the directive or the spec type it
+//was generated for is gone. target is a package pattern such as ./..., which covers go:generate directives
+//and annotations, or a configuration file, which covers only its own jobs
+func clean(target string, dryRun bool) {
+	root, jobs, errors := generateJobs(target)
+	isConfig := strings.HasSuffix(target, ".json")
+	dirs := []string{}
+	if isConfig {
+		dirs = packageDirs(root)
+	} else {
+		directives, errs := discover(target, generateDirectiveJobs)
+		jobs = append(jobs, directives...)
+		errors = append(errors, errs...)
+		dirs = patternDirs(target)
+	}
+	printErrors(errors)
+
+	//The files each current job produces, by output directory and entry
+	var (
+		g        = newGenerator(root, nil)
+		expected = map[string][]string{}
+		unknown  = map[string]bool{}
+	)
+	//Dependencies are generated along with the jobs that depend on them, so their files are current too
+	for i := 0; i < len(jobs); i++ {
+		deps, err := g.Dependencies(jobs[i])
+		if err != nil {
+			continue
+		}
+		for _, dep := range deps {
+			if !containsJob(jobs, dep) {
+				jobs = append(jobs, dep)
+			}
+		}
+	}
+
+	for _, job := range jobs {
+		outputDirectory, names, err := g.Outputs(job)
+		key := manifestKey(outputDirectory, g.manifestEntry(job, outputDirectory).ID())
+		if err != nil {
+			//Without knowing what a job produces, leave everything it produced alone
+			printErrors([]error{err})
+			unknown[key] = true
+			continue
+		}
+		expected[key] = names
+	}
+
+	for _, dir := range dirs {
+		m, err := loadManifest(dir)
+		if err != nil {
+			printErrors([]error{err})
+			continue
+		}
+
+		entries := []manifestEntry{}
+		stale := []string{}
+		for _, entry := range m.Entries {
+			key := manifestKey(dir, entry.ID())
+			if !inCleanScope(entry, isConfig, target, dir) || unknown[key] {
+				entries = append(entries, entry)
+				continue
+			}
+
+			//Entries without a current job are orphaned along with all of their files
+			names, current := expected[key]
+			if isTransformDirective(entry.Directive) {
+				names, current = transformOutputs(dir, entry)
+			}
+			kept := []string{}
+			for _, file := range entry.Files {
+				if containsString(names, file) {
+					kept = append(kept, file)
+				} else {
+					stale = append(stale, file)
+				}
+			}
+
+			if current {
+				entry.Files = kept
+				entries = append(entries, entry)
+			}
+		}
+
+		//Files the remaining entries still produce, such as alias wrappers, are kept
+		remaining := &manifest{Entries: entries}
+		unowned := []string{}
+		for _, file := range stale {
+			if !remaining.produces(file) && !containsString(unowned, file) {
+				unowned = append(unowned, file)
+			}
+		}
+		stale = unowned
+
+		if len(stale) == 0 {
+			continue
+		}
+
+		if dryRun {
+			for _, file := range stale {
+				fmt.Printf("Would remove %s\n", filepath.Join(dir, file))
+			}
+			continue
+		}
+
+		m.Entries = entries
+		printErrors(m.Remove(stale))
+		if err := m.Save(); err != nil {
+			printErrors([]error{err})
+		}
+	}
+}
+
+func containsJob(jobs []generateJob, job generateJob) bool {
+	for _, j := range jobs {
+		if j.String() == job.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func manifestKey(dir, id string) string {
+	return absPath(dir) + "|" + id
+}
+
+//A configuration file only knows about its own jobs, and a package pattern only knows about directives in the code
+func inCleanScope(entry manifestEntry, isConfig bool, config, dir string) bool {
+	if !isConfig {
+		return entry.Directive == generateDirective || entry.Directive == annotationDirective || isTransformDirective(entry.Directive)
+	}
+	return filepath.Join(absPath(dir), filepath.FromSlash(entry.Directive)) == absPath(config)
+}
+
+func isTransformDirective(directive string) bool {
+	return strings.HasPrefix(directive, generateDirective+" ")
+}
+
+//The files a transform such as deepcopy still generates into a directory: one for each type its spec file declares,
+//for as long as the spec file has a go:generate directive that runs it. Plugins are recorded the same way
+//A spec file that can't be parsed keeps everything it generated
+func transformOutputs(dir string, entry manifestEntry) (names []string, current bool) {
+	var (
+		transform = strings.TrimPrefix(entry.Directive, generateDirective+" ")
+		specFile  = filepath.Join(dir, filepath.FromSlash(entry.Job.Spec))
+	)
+	file, err := parser.ParseFile(token.NewFileSet(), specFile, nil, parser.ParseComments)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		return entry.Files, true
+	}
+
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			args := strings.Fields(strings.TrimPrefix(c.Text, "//"+generateDirective))
+			if !strings.HasPrefix(c.Text, "//"+generateDirective) || len(args) == 0 || args[0] != "goast" {
+				continue
+			}
+			for i := 1; i+1 < len(args); i++ {
+				current = current || (args[i] == "write" && args[i+1] == transform)
+			}
+		}
+	}
+	if !current {
+		return
+	}
+	//Plugins name their files as they like, so they're all kept while a directive still runs the plugin
+	if entry.Job.Generic != "" {
+		return entry.Files, true
+	}
+
+	cfg := writeConfig{Prefix: entry.Job.Prefix, Suffix: entry.Job.Suffix}
+	for _, decl := range file.Decls {
+		if g, ok := decl.(*ast.GenDecl); ok && g.Tok == token.TYPE {
+			for _, spec := range g.Specs {
+				names = append(names, generatedFileName(cfg, spec.(*ast.TypeSpec).Name.Name, transform+".go"))
+			}
+		}
+	}
+	return
+}
@@ -50,6 +50,17 @@ func (c *Context) complexityOfExpr(node ast.Expr) int {
 	case *ast.StarExpr:
 		return c.complexityOfExpr(nodeType.X)
 
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		if inst, ok := c.Instantiate(nodeType); ok {
+			return c.complexityOfExpr(inst) + 1
+		}
+		base, indices := indexExprParts(nodeType)
+		max := c.complexityOfExpr(base)
+		for _, index := range indices {
+			max = intMax(max, c.complexityOfExpr(index))
+		}
+		return max + 1
+
 	case *ast.ArrayType:
 		return c.complexityOfExpr(nodeType.Elt) + 1
 
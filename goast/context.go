@@ -3,12 +3,15 @@ package main
 import (
 	"bytes"
 	"go/ast"
+	"go/build"
 	"go/parser"
 	"go/printer"
 	"go/token"
+	"os"
 	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"golang.org/x/tools/go/ast/astutil"
 )
@@ -160,6 +163,13 @@ func (c *Context) LookupType(ident string) (t *ast.TypeSpec, ok bool) {
 	return
 }
 
+func (c *Context) LookupConst(ident string) (v *ast.ValueSpec, ok bool) {
+	if obj, exists := c.Lookup(ident); exists && obj.Kind == ast.Con {
+		v, ok = obj.Decl.(*ast.ValueSpec)
+	}
+	return
+}
+
 func (c *Context) LookupFunc(ident string) (t *ast.FuncDecl, ok bool) {
 	if obj, exists := c.Lookup(ident); exists {
 		t, ok = obj.Decl.(*ast.FuncDecl)
@@ -187,6 +197,19 @@ func (c *Context) ImportsOf(x ast.Expr) ImportSpecs {
 	return c.importsOfExpr(x)
 }
 
+//The imports an expression selects from directly, without the imports of the types it names
+//That's all code that refers to the expression from the same package needs
+func (c *Context) SelectedImports(x ast.Expr) (result ImportSpecs) {
+	ast.Inspect(x, func(node ast.Node) bool {
+		if sel, isSelector := node.(*ast.SelectorExpr); isSelector {
+			result = append(result, c.importsOfSelector(sel)...)
+			return false
+		}
+		return true
+	})
+	return
+}
+
 func (c *Context) importsOfExpr(x ast.Expr) (result ImportSpecs) {
 	// *Ident, *ParenExpr, *SelectorExpr, *StarExpr, or any of the *XxxTypes
 	switch t := x.(type) {
@@ -251,6 +274,13 @@ func (c *Context) importsOfSubExpr(x ast.Expr) (result ImportSpecs) {
 
 	case *ast.ChanType:
 		return c.importsOfExpr(t.Value)
+
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		base, indices := indexExprParts(t)
+		result = c.importsOfExpr(base)
+		for _, index := range indices {
+			result = append(result, c.importsOfExpr(index)...)
+		}
 	}
 	return result
 }
@@ -274,10 +304,15 @@ func (c *Context) AddImportFromSpec(spec *ast.ImportSpec) {
 }
 
 //Parse a given source file, and its enclosing package directory
+//Only files built with the current build constraints are included, along with the source file itself
 func NewFilePackageContext(sourceFile string) (*Context, error) {
 	fset := token.NewFileSet()
 	packagePath := filepath.Dir(sourceFile)
-	pkgs, err := parser.ParseDir(fset, packagePath, nil, 0)
+	filter := func(fi os.FileInfo) bool {
+		return fi.Name() == filepath.Base(sourceFile) || isBuiltFile(packagePath, fi)
+	}
+
+	pkgs, err := parser.ParseDir(fset, packagePath, filter, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -290,6 +325,47 @@ func NewFilePackageContext(sourceFile string) (*Context, error) {
 	return nil, nil
 }
 
+//Parse the package of a given source file as if it were one file, so every type in the package is provided
+//Files that aren't built are left out, along with any file skip reports, such as files generated into the package
+func NewPackageContext(sourceFile string, skip func(name string) bool) (*Context, error) {
+	fset := token.NewFileSet()
+	packagePath := filepath.Dir(sourceFile)
+	filter := func(fi os.FileInfo) bool {
+		if fi.Name() == filepath.Base(sourceFile) {
+			return true
+		}
+		return isBuiltFile(packagePath, fi) && !skip(fi.Name())
+	}
+
+	pkgs, err := parser.ParseDir(fset, packagePath, filter, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, parsed := range pkgs {
+		if _, exists := parsed.Files[sourceFile]; !exists {
+			continue
+		}
+
+		//Resolving the package gives it a scope, so types are looked up across files
+		//Imports aren't resolved, so the errors for their identifiers are expected
+		pkg, _ := ast.NewPackage(fset, parsed.Files, nil, nil)
+		file := ast.MergePackageFiles(pkg, ast.FilterImportDuplicates)
+		cmap := ast.NewCommentMap(fset, file, file.Comments)
+		return &Context{file, fset, pkg, cmap}, nil
+	}
+	return nil, nil
+}
+
+//Whether a file in a package directory is built under the build constraints of build.Default, see --tags
+//Test files never are, since generated code can't refer to what they declare
+func isBuiltFile(dir string, fi os.FileInfo) bool {
+	if strings.HasSuffix(fi.Name(), "_test.go") {
+		return false
+	}
+	match, err := build.Default.MatchFile(dir, fi.Name())
+	return err == nil && match
+}
+
 //Parse just a given source file, do not include package
 func NewFileContext(sourceFile string) (*Context, error) {
 	fset := token.NewFileSet()
@@ -301,6 +377,17 @@ func NewFileContext(sourceFile string) (*Context, error) {
 	return &Context{file, fset, nil, cmap}, nil
 }
 
+//Parse just a given source file along with its comments, for files that get rewritten in place
+func NewFileCommentContext(sourceFile string) (*Context, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, sourceFile, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	cmap := ast.NewCommentMap(fset, file, file.Comments)
+	return &Context{file, fset, nil, cmap}, nil
+}
+
 //Parse a source string as a given filename
 func NewSourceStringContext(source, name string) (*Context, error) {
 	fset := token.NewFileSet()
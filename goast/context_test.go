@@ -2,6 +2,13 @@ package main
 
 import (
 	"go/ast"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
 	"testing"
 )
 
@@ -90,3 +97,52 @@ func Test_ImportsOf(t *testing.T) {
 	}
 
 }
+
+func Test_NewFilePackageContextBuildConstraints(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	otherOS := "windows"
+	if runtime.GOOS == otherOS {
+		otherOS = "linux"
+	}
+
+	writeTestFiles(dir, map[string]string{
+		"spec.go":                  "package spec\ntype Ints []int",
+		"point.go":                 "package spec\ntype Point struct{ X, Y int }",
+		"point_" + otherOS + ".go": "package spec\ntype Point struct{ X, Y, Z int }",
+		"ignored.go":               "//go:build ignore\n\npackage main\ntype Point struct{}",
+		"tagged.go":                "//go:build extra\n\npackage spec\ntype Extra int",
+		"spec_test.go":             "package spec\ntype Tests []bool",
+	})
+
+	defer func(tags []string) { build.Default.BuildTags = tags }(build.Default.BuildTags)
+
+	tests := []struct {
+		Tags   []string
+		Expect []string
+	}{
+		{nil, []string{"point.go", "spec.go"}},
+		{[]string{"extra"}, []string{"point.go", "spec.go", "tagged.go"}},
+	}
+
+	for _, tst := range tests {
+		build.Default.BuildTags = tst.Tags
+		for _, scope := range []string{fileScope, packageScope} {
+			g := newGenerator(dir, nil)
+			c, err := g.spec(filepath.Join(dir, "spec.go"), scope)
+			if err != nil {
+				t.Fatalf("Expected %s scope to parse, found %s", scope, err)
+			}
+
+			files := []string{}
+			for name := range c.Package.Files {
+				files = append(files, filepath.Base(name))
+			}
+			sort.Strings(files)
+			if !reflect.DeepEqual(files, tst.Expect) {
+				t.Errorf("Expected %s scope with tags %v to parse %v, found %v", scope, tst.Tags, tst.Expect, files)
+			}
+		}
+	}
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+)
+
+//Generates Clone methods that deep copy spec types, e.g. for
+//	type Config struct{ Tags []string; Parent *Config }
+//Config gets Clone() Config, which copies the Tags slice and calls Clone on Parent
+//The copy is spelt out for each type, so it's as fast as copying by hand and doesn't use reflection
+//Chans, funcs and interfaces are shared by the copy, and fields tagged goast:"-" are left at their zero value
+type Cloner struct {
+	structural
+}
+
+func NewCloner(pkg *Context, dir string, types []string, cycles bool) *Cloner {
+	return &Cloner{newStructural(pkg, dir, types, cycles)}
+}
+
+func (c *Cloner) Transform(spec *Context) (codes SourceSet, ok bool, errors []error) {
+	specs, errors := c.specTypes(spec, "Clone")
+	for _, t := range specs {
+		source, err := c.clone(t)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("Cannot generate Clone for %s: %s", t.Name.Name, err))
+			continue
+		}
+		codes = append(codes, source)
+	}
+
+	if len(codes) == 0 && len(errors) == 0 {
+		errors = append(errors, fmt.Errorf("No type in %s to generate Clone for", spec.File.Name.Name))
+	}
+	ok = len(errors) == 0
+	return
+}
+
+func (c *Cloner) clone(t *ast.TypeSpec) (*SourceCode, error) {
+	c.reset()
+	var (
+		name          = t.Name.Name
+		rcvr, pointer = receiverOf(c.Package, name)
+		recvType, src = name, rcvr
+		body          bytes.Buffer
+		decls         bytes.Buffer
+	)
+	if pointer {
+		recvType, src = "*"+name, "(*"+rcvr+")"
+	}
+
+	if c.flat(t.Type, "Clone") {
+		fmt.Fprintf(&body, "return %s\n", unparen(src))
+	} else {
+		fmt.Fprintf(&body, "var clone %s\n", name)
+		if err := c.copyExpr(&body, "clone", src, t.Name, t.Type); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&body, "return clone\n")
+	}
+
+	if c.Cycles {
+		fmt.Fprintf(&decls, "\nfunc (%s %s) Clone() %s {\n\treturn %s.cloneVisited(map[interface{}]interface{}{})\n}\n", rcvr, recvType, name, rcvr)
+		fmt.Fprintf(&decls, "\nfunc (%s %s) cloneVisited(visited map[interface{}]interface{}) %s {\n%s}\n", rcvr, recvType, name, body.Bytes())
+	} else {
+		fmt.Fprintf(&decls, "\nfunc (%s %s) Clone() %s {\n%s}\n", rcvr, recvType, name, body.Bytes())
+	}
+	return generatedSource(c.Package, name, c.imports, decls.Bytes())
+}
+
+//Statements that set dst to a deep copy of src, where typ is how the type of src is spelt and x is its declaration
+func (c *Cloner) copyExpr(w *bytes.Buffer, dst, src string, typ, x ast.Expr) error {
+	if c.flat(x, "Clone") {
+		fmt.Fprintf(w, "%s = %s\n", unparen(dst), unparen(src))
+		return nil
+	}
+
+	// *Ident, *ParenExpr, *SelectorExpr, *StarExpr, or any of the *XxxTypes
+	switch t := x.(type) {
+	case *ast.ParenExpr:
+		return c.copyExpr(w, dst, src, typ, t.X)
+
+	case *ast.Ident:
+		if c.Cycles && c.selected[t.Name] {
+			fmt.Fprintf(w, "%s = %s(visited)\n", unparen(dst), selector(src, "cloneVisited"))
+			return nil
+		}
+		if c.callsMethod(t, "Clone") {
+			fmt.Fprintf(w, "%s = %s()\n", unparen(dst), selector(src, "Clone"))
+			return nil
+		}
+
+		decl, _, err := c.expand(t, "Clone")
+		if err != nil {
+			return err
+		}
+		c.expanding[t.Name] = true
+		defer delete(c.expanding, t.Name)
+		return c.copyExpr(w, dst, src, t, decl)
+
+	case *ast.SelectorExpr:
+		if !c.hasMethod(t, "Clone") {
+			return fmt.Errorf("Cannot copy %s, it holds maps or slices that would be shared and has no Clone method. Tag the field goast:\"-\" to ignore it", ExprString(t))
+		}
+		fmt.Fprintf(w, "%s = %s()\n", unparen(dst), selector(src, "Clone"))
+
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		inst, ok := c.Package.Instantiate(t)
+		if !ok {
+			return fmt.Errorf("Cannot copy %s, its declaration can't be instantiated", ExprString(t))
+		}
+		return c.copyExpr(w, dst, src, t, inst)
+
+	case *ast.StarExpr:
+		elem := c.spell(t.X)
+		fmt.Fprintf(w, "if %s != nil {\n", src)
+		if c.Cycles {
+			p := c.newVar("p")
+			fmt.Fprintf(w, "if %s, found := visited[%s]; found {\n%s = %s.(*%s)\n} else {\n", p, src, unparen(dst), p, elem)
+		}
+		fmt.Fprintf(w, "%s = new(%s)\n", unparen(dst), elem)
+		if c.Cycles {
+			fmt.Fprintf(w, "visited[%s] = %s\n", src, unparen(dst))
+		}
+		if err := c.copyExpr(w, "(*"+dst+")", "(*"+src+")", t.X, t.X); err != nil {
+			return err
+		}
+		if c.Cycles {
+			fmt.Fprintf(w, "}\n")
+		}
+		fmt.Fprintf(w, "}\n")
+
+	case *ast.ArrayType:
+		if t.Len == nil {
+			fmt.Fprintf(w, "if %s != nil {\n%s = make(%s, len(%s))\n", src, unparen(dst), c.spell(typ), src)
+		}
+		if t.Len == nil && c.flat(t.Elt, "Clone") {
+			fmt.Fprintf(w, "copy(%s, %s)\n", dst, src)
+		} else {
+			i := c.newVar("i")
+			fmt.Fprintf(w, "for %s := range %s {\n", i, src)
+			if err := c.copyExpr(w, dst+"["+i+"]", src+"["+i+"]", t.Elt, t.Elt); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "}\n")
+		}
+		if t.Len == nil {
+			fmt.Fprintf(w, "}\n")
+		}
+
+	case *ast.MapType:
+		k, v := c.newVar("k"), c.newVar("v")
+		fmt.Fprintf(w, "if %s != nil {\n%s = make(%s, len(%s))\n", src, unparen(dst), c.spell(typ), src)
+		fmt.Fprintf(w, "for %s, %s := range %s {\n", k, v, src)
+		if c.flat(t.Value, "Clone") {
+			fmt.Fprintf(w, "%s[%s] = %s\n", dst, k, v)
+		} else {
+			e := c.newVar("e")
+			fmt.Fprintf(w, "var %s %s\n", e, c.spell(t.Value))
+			if err := c.copyExpr(w, e, v, t.Value, t.Value); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%s[%s] = %s\n", dst, k, e)
+		}
+		fmt.Fprintf(w, "}\n}\n")
+
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if optedOut(field) {
+				continue
+			}
+			names := fieldNames(field)
+			if len(names) == 0 {
+				return fmt.Errorf("Cannot copy the embedded field %s", ExprString(field.Type))
+			}
+			for _, name := range names {
+				if name == "_" {
+					continue
+				}
+				if err := c.copyExpr(w, selector(dst, name), selector(src, name), field.Type, field.Type); err != nil {
+					return err
+				}
+			}
+		}
+
+	default:
+		return fmt.Errorf("Cannot copy %s", ExprString(x))
+	}
+	return nil
+}
+
+//Generate Clone methods for the types of a spec file, written next to it
+func deepcopy(specFile string, types []string, cycles bool, cfg writeConfig) {
+	fmt.Printf("Deep copy %s\n", specFile)
+	cfg.Types = types
+	transformSpec(specFile, "deepcopy.go", cfg, func(pkg *Context, dir string) AstTransform {
+		return NewCloner(pkg, dir, types, cycles)
+	})
+}
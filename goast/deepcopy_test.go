@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const structuralSpec = `package app
+
+import (
+	"sync"
+	"time"
+)
+
+type Tags []string
+
+type Point struct{ X, Y int }
+
+type attrs map[string]*Point
+
+type Node struct {
+	Name     string
+	Tags     Tags
+	Next     *Node
+	Children []*Node
+	Grid     [2][]int
+	Attrs    attrs
+	Started  time.Time
+	OnDone   func()
+	mu       sync.Mutex ` + "`goast:\"-\"`" + `
+}
+
+func (n *Node) Lock() { n.mu.Lock() }
+`
+
+func Test_DeepCopy(t *testing.T) {
+	tests := []struct {
+		Types          []string
+		Cycles         bool
+		Name           string
+		Expect, Reject []string
+	}{
+		{nil, false, "Tags", []string{
+			"func (t Tags) Clone() Tags {\n\tvar clone Tags\n\tif t != nil {\n\t\tclone = make(Tags, len(t))\n\t\tcopy(clone, t)\n\t}\n\treturn clone\n}",
+		}, nil},
+		{nil, false, "Point", []string{"func (p Point) Clone() Point {\n\treturn p\n}"}, nil},
+		{[]string{"Node", "Tags"}, false, "Node", []string{
+			"func (n *Node) Clone() Node {",
+			"\tclone.Tags = n.Tags.Clone()\n",
+			"\tif n.Next != nil {\n\t\tclone.Next = new(Node)\n\t\t*clone.Next = n.Next.Clone()\n\t}",
+			"\t\tfor i0 := range n.Children {\n\t\t\tif n.Children[i0] != nil {",
+			"\tfor i1 := range n.Grid {\n\t\tif n.Grid[i1] != nil {\n\t\t\tclone.Grid[i1] = make([]int, len(n.Grid[i1]))\n\t\t\tcopy(clone.Grid[i1], n.Grid[i1])",
+			"\t\tclone.Attrs = make(attrs, len(n.Attrs))\n",
+			"\t\t\tvar e4 *Point\n\t\t\tif v3 != nil {\n\t\t\t\te4 = new(Point)\n\t\t\t\t*e4 = *v3\n",
+			"\tclone.Started = n.Started\n\tclone.OnDone = n.OnDone\n",
+		}, []string{"mu", "reflect", "import"}},
+		{[]string{"Node", "Tags"}, true, "Node", []string{
+			"func (n *Node) Clone() Node {\n\treturn n.cloneVisited(map[interface{}]interface{}{})\n}",
+			"func (n *Node) cloneVisited(visited map[interface{}]interface{}) Node {",
+			"\t\tif p0, found := visited[n.Next]; found {\n\t\t\tclone.Next = p0.(*Node)\n\t\t} else {\n\t\t\tclone.Next = new(Node)\n\t\t\tvisited[n.Next] = clone.Next\n\t\t\t*clone.Next = n.Next.cloneVisited(visited)\n\t\t}",
+			"\tclone.Tags = n.Tags.cloneVisited(visited)\n",
+		}, nil},
+	}
+
+	for _, tst := range tests {
+		sources := transformedSource(t, structuralSpec, func(pkg *Context, dir string) AstTransform {
+			return NewCloner(pkg, dir, tst.Types, tst.Cycles)
+		})
+		src, found := sources[tst.Name]
+		if !found {
+			t.Errorf("Expected Clone for %s, found %v", tst.Name, sources)
+			continue
+		}
+		for _, expect := range tst.Expect {
+			if !strings.Contains(src, expect) {
+				t.Errorf("Expected Clone of %s to contain\n%s\nfound\n%s", tst.Name, expect, src)
+			}
+		}
+		for _, reject := range tst.Reject {
+			if strings.Contains(src, reject) {
+				t.Errorf("Expected Clone of %s not to contain %s, found\n%s", tst.Name, reject, src)
+			}
+		}
+	}
+}
+
+func Test_DeepCopyErrors(t *testing.T) {
+	tests := []struct {
+		Types  []string
+		Source string
+		Expect string
+	}{
+		{[]string{"List"}, "package app\n\ntype List struct{ Next *elem }\n\ntype elem struct{ Next *elem }\n", "elem is recursive"},
+		{[]string{"Reader"}, "package app\n\ntype Reader interface{ Read() }\n", "it's an interface or generic"},
+		{nil, "package app\n\ntype Point struct{ X int }\n\nfunc (p Point) Clone() Point { return p }\n", "No type in app"},
+		{nil, "package app\n\nimport \"bytes\"\n\ntype Request struct{ Body bytes.Buffer }\n", "Cannot copy bytes.Buffer"},
+	}
+
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+	specFile := filepath.Join(dir, "app", "app.go")
+
+	for _, tst := range tests {
+		writeTestFiles(dir, map[string]string{"app/app.go": tst.Source})
+		spec, _ := NewFileContext(specFile)
+		pkg, _ := NewPackageContext(specFile, func(string) bool { return false })
+		_, ok, errors := NewCloner(pkg, filepath.Dir(specFile), tst.Types, false).Transform(spec)
+		if ok || len(errors) == 0 || !strings.Contains(errors[0].Error(), tst.Expect) {
+			t.Errorf("Expected an error containing %q, found %v", tst.Expect, errors)
+		}
+	}
+}
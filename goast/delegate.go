@@ -0,0 +1,221 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"strings"
+	"unicode"
+)
+
+//Generates methods on spec structs that forward to a field, for every method of the field the struct doesn't declare itself
+//Decorators then only declare the methods they override, e.g. for
+//	type LoggingStore struct{ inner Store }
+//every method of Store other than the ones LoggingStore declares is forwarded to inner
+type Delegator struct {
+	methodResolver
+	//Field to forward to. Every field of interface type when empty
+	Field string
+	//Structs to generate for. Every struct with a field to forward to when empty
+	Types []string
+}
+
+//A method to generate, and the field it forwards to
+type forwardedMethod struct {
+	declaredMethod
+	Field string
+}
+
+func NewDelegator(pkg *Context, dir, field string, types []string) *Delegator {
+	return &Delegator{newMethodResolver(pkg, dir), field, types}
+}
+
+func (d *Delegator) Transform(spec *Context) (codes SourceSet, ok bool, errors []error) {
+	var types typeSet = spec.Types()
+	types.Each(func(t *ast.TypeSpec) {
+		st, isStruct := t.Type.(*ast.StructType)
+		if !isStruct || (len(d.Types) != 0 && !containsString(d.Types, t.Name.Name)) {
+			return
+		}
+
+		source, err := d.delegate(t.Name.Name, st)
+		if err != nil {
+			errors = append(errors, err)
+		} else if source != nil {
+			codes = append(codes, source)
+		}
+	})
+
+	if len(codes) == 0 && len(errors) == 0 {
+		errors = append(errors, fmt.Errorf("No struct in %s has a field to delegate to", spec.File.Name.Name))
+	}
+	ok = len(errors) == 0
+	return
+}
+
+func (d *Delegator) delegatesTo(field *ast.Field) bool {
+	if len(field.Names) == 0 {
+		return false
+	}
+	if d.Field != "" {
+		return field.Names[0].Name == d.Field
+	}
+	return d.isInterface(d.Package, field.Type)
+}
+
+func (d *Delegator) isInterface(ctx *Context, x ast.Expr) bool {
+	switch t := x.(type) {
+	case *ast.InterfaceType:
+		return true
+	case *ast.Ident:
+		spec, isType := ctx.LookupType(t.Name)
+		return isType && d.isInterface(ctx, spec.Type)
+	case *ast.SelectorExpr:
+		if pkg, i, err := d.importedPackage(ctx, t); err == nil && i != nil {
+			return d.isInterface(pkg, t.Sel)
+		}
+	}
+	return false
+}
+
+//Forwarding methods for one struct, or nil when it has no field to delegate to
+func (d *Delegator) delegate(name string, st *ast.StructType) (source *SourceCode, err error) {
+	var (
+		declared  = map[string]bool{}
+		forwarded []forwardedMethod
+		delegated bool
+	)
+
+	//Methods can't share a name with a field either
+	for _, field := range st.Fields.List {
+		for _, id := range field.Names {
+			declared[id.Name] = true
+		}
+	}
+
+	//Fields are forwarded to in the order they're declared, so the first field with a method gets it
+	for _, field := range st.Fields.List {
+		if !d.delegatesTo(field) {
+			continue
+		}
+		delegated = true
+
+		methods, err := d.methodsOf(d.Package, nil, field.Type, map[string]bool{})
+		if err != nil {
+			return nil, fmt.Errorf("Cannot delegate %s.%s: %s", name, field.Names[0].Name, err)
+		}
+		for _, m := range methods {
+			//Unexported methods of another package can't be called
+			if m.From != nil && !ast.IsExported(m.Name) {
+				continue
+			}
+			if _, exists := d.Package.LookupMethod(name, m.Name); exists || declared[m.Name] {
+				continue
+			}
+			declared[m.Name] = true
+			forwarded = append(forwarded, forwardedMethod{m, field.Names[0].Name})
+		}
+	}
+
+	if !delegated || len(forwarded) == 0 {
+		return
+	}
+
+	rcvr, pointer := receiverOf(d.Package, name)
+	for _, m := range forwarded {
+		//Calling a pointer method through a field that isn't a pointer needs the struct to be addressable
+		if field, _ := fieldNamed(st, m.Field); m.Pointer && !isPointer(field.Type) {
+			pointer = true
+		}
+	}
+	recvType := name
+	if pointer {
+		recvType = "*" + name
+	}
+
+	var (
+		imports ImportSpecs
+		methods bytes.Buffer
+	)
+	for _, m := range forwarded {
+		imports = append(imports, m.imports()...)
+		writeForwardingMethod(&methods, rcvr, recvType, m)
+	}
+
+	if source, err = generatedSource(d.Package, name, imports, methods.Bytes()); err != nil {
+		err = fmt.Errorf("Cannot generate the forwarding methods of %s: %s", name, err)
+	}
+	return
+}
+
+//The receiver name and kind a type's methods already use, so generated methods match them
+//Types without methods get value receivers named after their initial
+func receiverOf(pkg *Context, name string) (rcvr string, pointer bool) {
+	for _, f := range pkg.Funcs() {
+		if recvName, ok := methodRecieverTypeIdentifier(f); !ok || recvName != name {
+			continue
+		}
+		field := f.Recv.List[0]
+		pointer = pointer || isPointer(field.Type)
+		if rcvr == "" && len(field.Names) != 0 && field.Names[0].Name != "_" {
+			rcvr = field.Names[0].Name
+		}
+	}
+
+	if rcvr == "" {
+		rcvr = string(unicode.ToLower([]rune(name)[0]))
+	}
+	return
+}
+
+func fieldNamed(st *ast.StructType, name string) (*ast.Field, bool) {
+	for _, field := range st.Fields.List {
+		for _, id := range field.Names {
+			if id.Name == name {
+				return field, true
+			}
+		}
+	}
+	return nil, false
+}
+
+//A method with the given receiver that forwards its arguments to the same method of a field
+func writeForwardingMethod(w *bytes.Buffer, rcvr, recvType string, m forwardedMethod) {
+	sig := m.signature()
+
+	args := nameParams(sig, rcvr)
+	unnameResults(sig)
+
+	call := fmt.Sprintf("%s.%s.%s(%s)", rcvr, m.Field, m.Name, strings.Join(args, ", "))
+	if sig.Results != nil && sig.Results.NumFields() != 0 {
+		call = "return " + call
+	}
+
+	fmt.Fprintf(w, "\nfunc (%s %s) %s%s {\n\t%s\n}\n", rcvr, recvType, m.Name, strings.TrimPrefix(ExprString(sig), "func"), call)
+}
+
+//Generate forwarding methods for the structs of a spec file, written next to it
+func delegate(specFile, field string, targets []string, cfg writeConfig) {
+	fmt.Printf("Delegate %s\n", specFile)
+	cfg.Types = targets
+	transformSpec(specFile, "delegate.go", cfg, func(pkg *Context, dir string) AstTransform {
+		return NewDelegator(pkg, dir, field, targets)
+	})
+}
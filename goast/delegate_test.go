@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const delegateSpec = `package app
+
+import (
+	"io"
+	"time"
+)
+
+type Store interface {
+	io.Closer
+	Get(key string) ([]byte, error)
+	Put(string, []byte, time.Duration)
+	Keys(prefix string, limit ...int) (keys []string, more bool)
+}
+
+type Logging struct {
+	inner Store
+	name  string
+}
+
+func (l *Logging) Get(key string) ([]byte, error) { return l.inner.Get(key) }
+
+type Counter struct{ n int }
+
+func (c *Counter) Inc() { c.n++ }
+func (c Counter) Value() int { return c.n }
+
+type Counted struct {
+	counter Counter
+	Store
+}
+`
+
+func Test_Delegate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+	writeTestFiles(dir, map[string]string{"app/app.go": delegateSpec})
+	specFile := filepath.Join(dir, "app", "app.go")
+
+	tests := []struct {
+		Field  string
+		Types  []string
+		Name   string
+		Expect []string
+		Absent []string
+	}{
+		{"", nil, "logging", []string{
+			"import \"time\"\n",
+			"func (l *Logging) Close() error {\n\treturn l.inner.Close()\n}",
+			"func (l *Logging) Put(arg0 string, arg1 []byte, arg2 time.Duration) {\n\tl.inner.Put(arg0, arg1, arg2)\n}",
+			"func (l *Logging) Keys(prefix string, limit ...int) ([]string, bool) {\n\treturn l.inner.Keys(prefix, limit...)\n}",
+		}, []string{"Get"}},
+		{"counter", []string{"Counted"}, "counted", []string{
+			"func (c *Counted) Inc() {\n\tc.counter.Inc()\n}",
+			"func (c *Counted) Value() int {\n\treturn c.counter.Value()\n}",
+		}, []string{"Close"}},
+	}
+
+	for _, tst := range tests {
+		spec, _ := NewFileContext(specFile)
+		pkg, _ := NewPackageContext(specFile, func(string) bool { return false })
+
+		codes, ok, errors := NewDelegator(pkg, filepath.Dir(specFile), tst.Field, tst.Types).Transform(spec)
+		code, found := codes.First(func(s *SourceCode) bool { return strings.ToLower(s.Name) == tst.Name })
+		if !ok || !found {
+			t.Errorf("Expected forwarding methods for %s, found %d files %v", tst.Name, len(codes), errors)
+			continue
+		}
+
+		var b bytes.Buffer
+		format.Node(&b, code.FileSet, code.File)
+		src := b.String()
+		for _, expect := range tst.Expect {
+			if !strings.Contains(src, expect) {
+				t.Errorf("Expected %s to contain\n%s\nfound\n%s", tst.Name, expect, src)
+			}
+		}
+		for _, absent := range tst.Absent {
+			if strings.Contains(src, ") "+absent+"(") {
+				t.Errorf("Expected %s to not forward %s, found\n%s", tst.Name, absent, src)
+			}
+		}
+	}
+}
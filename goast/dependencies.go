@@ -0,0 +1,207 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+//Generic libraries can build on each other. A sort library that calls iter's Where on its Slice type
+//can't be implemented for a spec type until iter has been, so the spec type has a Where method too
+//A generic file depends on another generic when it either
+//	- has a go:generate directive that implements the other generic on it
+//	- calls methods of its types that goast generated into its package from the other generic
+//Implementing a generic first implements its dependencies for the same spec types, see generator.Dependencies
+
+//The generics a generic file depends on, in the order they're found
+func genericDependencies(gen *Context, genericFile string) (deps []string, err error) {
+	file, err := parser.ParseFile(token.NewFileSet(), genericFile, nil, parser.ParseComments)
+	if err != nil {
+		return
+	}
+
+	found := map[string]bool{genericFile: true}
+	add := func(generic string) {
+		if !found[generic] {
+			found[generic] = true
+			deps = append(deps, generic)
+		}
+	}
+
+	//Errors in unrelated directives are left for whoever runs them
+	jobs, _ := generateDirectiveJobs(file, genericFile)
+	for _, job := range jobs {
+		add(job.Generic)
+	}
+
+	called := calledMethods(gen.File)
+	generated, err := generatedMethods(filepath.Dir(genericFile))
+	if err != nil {
+		return
+	}
+	for _, g := range generated {
+		for _, name := range g.Methods {
+			if called[name] {
+				add(g.Generic)
+				break
+			}
+		}
+	}
+	return
+}
+
+//The names of the methods a file calls on values of its own types, which are the only ones generated methods could be
+//Calls on values whose type can't be told are left out, as are calls of functions in other packages like fmt.Println
+func calledMethods(file *ast.File) map[string]bool {
+	var (
+		called = map[string]bool{}
+		decls  = genericDeclsOf(file)
+	)
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, isCall := node.(*ast.CallExpr)
+		if !isCall {
+			return true
+		}
+		sel, isSelector := call.Fun.(*ast.SelectorExpr)
+		if !isSelector {
+			return true
+		}
+		t := decls.typeOf(sel.X)
+		if star, isStar := t.(*ast.StarExpr); isStar {
+			t = star.X
+		}
+		if id, isIdent := t.(*ast.Ident); isIdent {
+			if _, declared := typeSpecOf(id); declared {
+				called[sel.Sel.Name] = true
+			}
+		}
+		return true
+	})
+	return called
+}
+
+//The methods goast generated into a directory from a generic
+type generatedGeneric struct {
+	Generic string
+	Methods []string
+}
+
+//The methods of every file goast generated in a directory, by the generic they were generated from
+//Generic files are relative to the manifest, so they're made relative to the working directory like any other
+func generatedMethods(dir string) (generated []generatedGeneric, err error) {
+	m, err := loadManifest(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range m.Entries {
+		g := generatedGeneric{Generic: entry.Job.Generic}
+		if strings.HasSuffix(g.Generic, ".go") && !filepath.IsAbs(g.Generic) {
+			g.Generic = filepath.Join(dir, filepath.FromSlash(g.Generic))
+		}
+
+		for _, name := range entry.Files {
+			file, parseErr := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, 0)
+			if parseErr != nil {
+				continue
+			}
+			for _, decl := range file.Decls {
+				if f, isFunc := decl.(*ast.FuncDecl); isFunc && f.Recv != nil {
+					g.Methods = append(g.Methods, f.Name.Name)
+				}
+			}
+		}
+		generated = append(generated, g)
+	}
+	return
+}
+
+//The jobs that implement the dependencies of a job's generic, for the spec types the job implements it for
+//Dependencies are generated alongside the job's own files, but not merged into its single file
+func (g *generator) Dependencies(job generateJob) (deps []generateJob, err error) {
+	imp, files, _, err := g.prepare(job)
+	if err != nil {
+		return
+	}
+	return g.dependencies(job, imp, files)
+}
+
+//The dependencies of a prepared job, see Dependencies
+//The spec types are only found by implementing the generic files that have dependencies
+func (g *generator) dependencies(job generateJob, imp *Implementor, files []string) (deps []generateJob, err error) {
+	var (
+		generics []string
+		types    = map[string][]string{}
+	)
+	for _, genericFile := range files {
+		gen, err := g.generic(genericFile)
+		if err != nil {
+			return nil, err
+		}
+		found, err := g.genericDependencies(gen, genericFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			continue
+		}
+
+		//The spec types bound to the generic's types are the ones its dependencies' methods are called on
+		codes, _, _ := imp.Transform(gen)
+		for _, generic := range found {
+			if _, seen := types[generic]; !seen {
+				generics = append(generics, generic)
+				types[generic] = []string{}
+			}
+			for _, code := range codes {
+				if !containsString(types[generic], code.Name) {
+					types[generic] = append(types[generic], code.Name)
+				}
+			}
+		}
+	}
+
+	for _, generic := range generics {
+		if len(types[generic]) == 0 {
+			continue
+		}
+		types := types[generic]
+		if strings.HasSuffix(generic, ".go") {
+			generic = absPath(generic)
+		}
+		dep := job
+		dep.Generic, dep.Bindings, dep.Types, dep.SingleFile = generic, nil, types, ""
+		deps = append(deps, dep)
+	}
+	return
+}
+
+//The dependencies of a generic file, found once for each generic a generator implements
+func (g *generator) genericDependencies(gen *Context, genericFile string) (deps []string, err error) {
+	if deps, found := g.dependencyCache[genericFile]; found {
+		return deps, nil
+	}
+	if deps, err = genericDependencies(gen, genericFile); err == nil {
+		g.dependencyCache[genericFile] = deps
+	}
+	return
+}
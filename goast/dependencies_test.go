@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	dependencyIter = `package iter
+
+type T interface{}
+
+type Iter []T
+
+func (i Iter) Where(fn func(T) bool) (result Iter) {
+	for _, v := range i {
+		if fn(v) {
+			result = append(result, v)
+		}
+	}
+	return
+}
+`
+	dependencySort = `package sort
+
+type T interface{}
+
+type Slice []T
+
+func (s Slice) Positive(keep func(T) bool) Slice {
+	return s.Where(keep)
+}
+`
+)
+
+func Test_GenericDependencies(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		Files  map[string]string
+		Expect []string
+	}{
+		{map[string]string{"sort/sort.go": dependencySort}, nil},
+		{map[string]string{"sort/sort.go": "//go:generate goast write impl --prefix=gen_ ../iter/iter.go\n" + dependencySort}, []string{"iter/iter.go"}},
+		{map[string]string{
+			"sort/sort.go":        dependencySort,
+			"sort/slice_iter.go":  "package sort\n\nfunc (i Slice) Where(fn func(T) bool) Slice { return i }\n",
+			"sort/goast.manifest": `{"entries": [{"directive": "go:generate", "job": {"generic": "../iter/iter.go", "spec": "sort.go"}, "files": ["slice_iter.go"]}]}`,
+		}, []string{"iter/iter.go"}},
+		{map[string]string{
+			"sort/sort.go":        dependencySort,
+			"sort/slice_map.go":   "package sort\n\nfunc (s Slice) Map(fn func(T) T) Slice { return s }\n",
+			"sort/goast.manifest": `{"entries": [{"directive": "go:generate", "job": {"generic": "goast.net/x/iter", "spec": "sort.go"}, "files": ["slice_map.go"]}]}`,
+		}, nil},
+		//Methods called on values of other packages' types aren't generated ones, even with the same name
+		{map[string]string{
+			"sort/sort.go":        "package sort\n\nimport \"strings\"\n\ntype T interface{}\n\ntype Slice []T\n\nfunc (s Slice) Name(b *strings.Builder) string {\n\tb.Grow(len(s))\n\treturn strings.ToLower(b.String())\n}\n",
+			"sort/slice_str.go":   "package sort\n\nfunc (s Slice) String() string { return \"\" }\nfunc (s Slice) ToLower() Slice { return s }\n",
+			"sort/goast.manifest": `{"entries": [{"directive": "go:generate", "job": {"generic": "../str/str.go", "spec": "sort.go"}, "files": ["slice_str.go"]}]}`,
+		}, nil},
+	}
+
+	for _, tst := range tests {
+		os.RemoveAll(filepath.Join(dir, "sort"))
+		writeTestFiles(dir, tst.Files)
+		genericFile := filepath.Join(dir, "sort", "sort.go")
+		gen, _ := NewFileContext(genericFile)
+
+		deps, err := genericDependencies(gen, genericFile)
+		found := []string{}
+		for _, dep := range deps {
+			rel, _ := filepath.Rel(dir, dep)
+			found = append(found, filepath.ToSlash(rel))
+		}
+		if err != nil || len(found) != len(tst.Expect) || (len(found) != 0 && !reflect.DeepEqual(found, tst.Expect)) {
+			t.Errorf("Expected dependencies %v, found %v %v", tst.Expect, found, err)
+		}
+	}
+}
+
+func Test_GenerateDependencies(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	writeTestFiles(dir, map[string]string{
+		"iter/iter.go": dependencyIter,
+		"sort/sort.go": "//go:generate goast write impl ../iter/iter.go\n" + dependencySort,
+		"app/main.go":  "package main\n\ntype Ints []int\n\ntype Point struct{ X int }\n",
+	})
+
+	job := generateJob{Generic: filepath.Join(dir, "sort", "sort.go"), Spec: filepath.Join(dir, "app", "main.go"), Directive: generateDirective}
+	if errors := newGenerator(".", nil).Run(job); len(errors) != 0 {
+		t.Fatalf("Expected the generic and its dependency to be implemented, found %v", errors)
+	}
+
+	expect := map[string]string{
+		"ints_iter.go": "func (i Ints) Where(fn func(int) bool) (result Ints)",
+		"ints_sort.go": "func (s Ints) Positive(keep func(int) bool) Ints",
+	}
+	for name, src := range expect {
+		b, err := ioutil.ReadFile(filepath.Join(dir, "app", name))
+		if err != nil || !strings.Contains(string(b), src) {
+			t.Errorf("Expected %s to contain %q, found %q %v", name, src, b, err)
+		}
+	}
+
+	m, _ := loadManifest(filepath.Join(dir, "app"))
+	if len(m.Entries) != 2 || !reflect.DeepEqual(m.Entries[0].Job.Types, []string{"Ints"}) {
+		t.Errorf("Expected the dependency to be recorded for Ints, found %+v", m.Entries)
+	}
+}
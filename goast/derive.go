@@ -0,0 +1,167 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"go/ast"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//Generic types that are composed of other generic types, along with the generic types they're composed of
+//e.g. type OrderedMap struct{ Map; Keys Slice } makes OrderedMap, Map and Slice composite
+//When the spec doesn't provide one of them it is derived instead: declared in the implementation,
+//from the bindings of the generic types it is declared with, see derivedTypeName
+func compositeTypes(implTypes typeSet) map[string]bool {
+	containers := map[string]bool{}
+	implTypes.Each(func(t *ast.TypeSpec) {
+		if !isEmptyInterface(t.Type) {
+			containers[t.Name.Name] = true
+		}
+	})
+
+	composite := map[string]bool{}
+	implTypes.Each(func(t *ast.TypeSpec) {
+		if !containers[t.Name.Name] {
+			return
+		}
+		for _, id := range declaredWith(t.Type) {
+			if containers[id.Name] && id.Name != t.Name.Name {
+				composite[t.Name.Name] = true
+				composite[id.Name] = true
+			}
+		}
+	})
+	return composite
+}
+
+//The identifiers of the types an expression is declared with, skipping field names and types of other packages
+func declaredWith(x ast.Expr) (idents []*ast.Ident) {
+	ast.Inspect(x, func(node ast.Node) bool {
+		switch t := node.(type) {
+		case *ast.Field:
+			idents = append(idents, declaredWith(t.Type)...)
+			return false
+
+		case *ast.SelectorExpr:
+			return false
+
+		case *ast.Ident:
+			idents = append(idents, t)
+		}
+		return true
+	})
+	return
+}
+
+//Reorder the generic types to solve for when no spec type implements the primary composite type
+//Composite types without spec types that implement them are moved last, simplest first, so the types
+//they're declared with are bound by the time they're derived. The primary composite type is always moved,
+//as none of its candidates led to a solution
+func derivingOrder(implTypes typeSet, domains [][]assignment, errs [][]error, composite map[string]bool) (types typeSet, ordered [][]assignment, orderedErrs [][]error, ok bool) {
+	kept, moved := []int{}, []int{}
+	for i, t := range implTypes {
+		if composite[t.Name.Name] && (i == 0 || len(domains[i]) == 0) {
+			moved = append(moved, i)
+		} else {
+			kept = append(kept, i)
+		}
+	}
+
+	//A primary type parameter would make every spec type a candidate
+	if len(moved) == 0 || len(kept) == 0 || isEmptyInterface(implTypes[kept[0]].Type) {
+		return
+	}
+
+	//Types are ordered most complex first, so the moved types are reversed
+	sort.Sort(sort.Reverse(sort.IntSlice(moved)))
+	for _, i := range append(kept, moved...) {
+		types = append(types, implTypes[i])
+		ordered = append(ordered, domains[i])
+		orderedErrs = append(orderedErrs, errs[i])
+	}
+	ok = true
+	return
+}
+
+//The name of the type a composite generic type is derived as, from the binding of the first generic type
+//it is declared with, e.g. OrderedMap with Map bound to Scores is ScoresOrderedMap
+//A type can't be derived until every generic type it is declared with is bound
+func derivedTypeName(gen *Context, t *ast.TypeSpec, bindings ImplMap) (name string, ok bool) {
+	prefix := ""
+	for _, id := range declaredWith(t.Type) {
+		if _, generic := gen.LookupType(id.Name); !generic {
+			continue
+		}
+		x, bound := bindings[id.Name]
+		if !bound {
+			return
+		}
+		if prefix == "" {
+			prefix = NiceName(x)
+		}
+	}
+
+	name = t.Name.Name
+	if !ast.IsExported(name) && prefix != "" {
+		r, size := utf8.DecodeRuneInString(prefix)
+		name = string(unicode.ToLower(r)) + prefix[size:] + strings.Title(name)
+	} else {
+		name = prefix + name
+	}
+	return name, true
+}
+
+//Derived types are bound to identifiers marked as such, so the rewrite knows to declare them
+const derivedMark = "derived"
+
+func derivedIdent(name string) *ast.Ident {
+	return &ast.Ident{Name: name, Obj: &ast.Object{Kind: ast.Typ, Name: name, Data: derivedMark}}
+}
+
+func isDerived(x ast.Expr) bool {
+	id, ok := x.(*ast.Ident)
+	return ok && id.Obj != nil && id.Obj.Data == derivedMark
+}
+
+//Generic types with methods declared on them, which must be implemented by named types
+func receiverTypes(gen *Context) map[string]bool {
+	receivers := map[string]bool{}
+	for _, f := range gen.Funcs() {
+		if name, ok := methodRecieverTypeIdentifier(f); ok {
+			receivers[name] = true
+		}
+	}
+	return receivers
+}
+
+//Methods can only be declared on named types, so a generic type with methods can't be implemented by e.g. []string
+func isUnnamedType(x ast.Expr) bool {
+	switch t := x.(type) {
+	case *ast.Ident, *ast.SelectorExpr, *ast.IndexExpr, *ast.IndexListExpr:
+		return false
+
+	case *ast.ParenExpr:
+		return isUnnamedType(t.X)
+
+	default:
+		return true
+	}
+}
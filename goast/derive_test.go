@@ -0,0 +1,95 @@
+package main
+
+import (
+	"go/parser"
+	"strings"
+	"testing"
+)
+
+const compositeGeneric = `type K interface{}
+type V interface{}
+type Map map[K]V
+func (m Map) Get(k K) V { return m[k] }
+type Slice []K
+func (s Slice) Len() int { return len(s) }
+type OrderedMap struct {
+	Map
+	Keys Slice
+}
+func (o *OrderedMap) Size() int { return o.Keys.Len() }`
+
+func Test_CompositeTypes(t *testing.T) {
+	tests := []struct {
+		Spec           string
+		Expect, Reject []string
+	}{
+		{`type Index struct {
+			Scores
+			Keys Names
+		  }
+		  type Scores map[string]int
+		  type Names []string`,
+			[]string{"func (o *Index) Size() int", "func (s Names) Len() int", "func (m Scores) Get(k string) int"},
+			[]string{"type ScoresOrderedMap", "type StringSlice"}},
+		{"type Scores map[string]int",
+			[]string{"type StringSlice []string", "func (s StringSlice) Len() int", "Keys StringSlice", "func (o *ScoresOrderedMap) Size() int"},
+			nil},
+		{`type Scores map[string]int
+		  type Names []string`,
+			[]string{"type ScoresOrderedMap struct", "Keys Names", "func (s Names) Len() int"},
+			[]string{"type StringSlice"}},
+		//Index can't have the methods of OrderedMap without Keys having the methods of Slice
+		{`type Index struct {
+			Scores
+			Keys []string
+		  }
+		  type Scores map[string]int`,
+			[]string{"type ScoresOrderedMap struct"},
+			[]string{"func (s []string)", "func (o *Index)"}},
+	}
+
+	for _, tst := range tests {
+		src, err := transformSource(compositeGeneric, tst.Spec)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		src = strings.Join(strings.Fields(src), " ")
+		for _, expect := range tst.Expect {
+			if !strings.Contains(src, expect) {
+				t.Errorf("Expected %q in implementation:\n%s", expect, src)
+			}
+		}
+		for _, reject := range tst.Reject {
+			if strings.Contains(src, reject) {
+				t.Errorf("Unexpected %q in implementation:\n%s", reject, src)
+			}
+		}
+	}
+}
+
+func Test_DerivedTypeName(t *testing.T) {
+	gen, _ := NewSourceStringContext("package gen\n"+compositeGeneric+"\ntype orderedSet struct{ Keys Slice }", "gen.go")
+
+	tests := []struct {
+		Bindings     map[string]string
+		Type, Expect string
+	}{
+		{map[string]string{"K": "string"}, "Slice", "StringSlice"},
+		{map[string]string{"Map": "scores", "K": "string"}, "OrderedMap", ""},
+		{map[string]string{"Map": "scores", "Slice": "Names"}, "OrderedMap", "ScoresOrderedMap"},
+		{map[string]string{"Slice": "[]string"}, "orderedSet", "stringSliceOrderedSet"},
+	}
+
+	for _, tst := range tests {
+		bindings := NewImplMap()
+		for name, binding := range tst.Bindings {
+			x, _ := parser.ParseExpr(binding)
+			bindings.Store(name, x)
+		}
+		spec, _ := gen.LookupType(tst.Type)
+		if found, ok := derivedTypeName(gen, spec, bindings); ok != (tst.Expect != "") || found != tst.Expect {
+			t.Errorf("Expected %s to be derived as %q, found %q", tst.Type, tst.Expect, found)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+//Generates methods for enums, named integer types with a block of constants, e.g. for
+//	type Color int
+//	const (
+//		Red Color = iota
+//		Green
+//	)
+//Color gets String, ParseColor, ColorValues, and text and JSON marshalling by name
+type Enumerator struct {
+	//Spec package, so methods the spec types already have aren't generated again
+	Package *Context
+	//Types to generate for. Every enum in the spec file when empty
+	Types []string
+	//Prefix trimmed from constant names to give the names of their values, e.g. Color for ColorRed
+	TrimPrefix string
+}
+
+//A constant of an enum and its value
+type enumValue struct {
+	Name  string
+	Value constant.Value
+}
+
+func NewEnumerator(pkg *Context, types []string, trimPrefix string) *Enumerator {
+	return &Enumerator{pkg, types, trimPrefix}
+}
+
+func (e *Enumerator) Transform(spec *Context) (codes SourceSet, ok bool, errors []error) {
+	values, failed := enumValues(spec.File)
+
+	var types typeSet = spec.Types()
+	types.Each(func(t *ast.TypeSpec) {
+		name := t.Name.Name
+		if len(e.Types) != 0 && !containsString(e.Types, name) {
+			return
+		}
+
+		kind, isInteger := e.integerKind(t.Type)
+		switch {
+		case !isInteger || (len(values[name]) == 0 && failed[name] == nil):
+			if len(e.Types) != 0 {
+				errors = append(errors, fmt.Errorf("Cannot generate an enum for %s, it isn't an integer type with constants", name))
+			}
+		case failed[name] != nil:
+			errors = append(errors, fmt.Errorf("Cannot generate the enum %s: %s", name, failed[name]))
+		default:
+			source, err := e.enum(name, strings.HasPrefix(kind, "u") || kind == "byte", values[name])
+			if err != nil {
+				errors = append(errors, fmt.Errorf("Cannot generate the enum %s: %s", name, err))
+			} else if source != nil {
+				codes = append(codes, source)
+			}
+		}
+	})
+
+	if len(codes) == 0 && len(errors) == 0 {
+		errors = append(errors, fmt.Errorf("No integer type in %s has constants to generate an enum for", spec.File.Name.Name))
+	}
+	ok = len(errors) == 0
+	return
+}
+
+//The predeclared integer type a type is declared as, following named types
+func (e *Enumerator) integerKind(x ast.Expr) (string, bool) {
+	switch t := x.(type) {
+	case *ast.ParenExpr:
+		return e.integerKind(t.X)
+	case *ast.Ident:
+		if spec, isType := e.Package.LookupType(t.Name); isType {
+			return e.integerKind(spec.Type)
+		}
+		switch t.Name {
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte", "rune":
+			return t.Name, true
+		}
+	}
+	return "", false
+}
+
+//The names of an enum's functions, exported only if the enum is
+func enumNames(name string) (parse, values string) {
+	if ast.IsExported(name) {
+		return "Parse" + name, name + "Values"
+	}
+	return "parse" + strings.Title(name), name + "Values"
+}
+
+func (e *Enumerator) enum(name string, unsigned bool, values []enumValue) (*SourceCode, error) {
+	var (
+		parse, valuesFunc = enumNames(name)
+		rcvr, _           = receiverOf(e.Package, name)
+		decls             bytes.Buffer
+		names             []string
+		named             = map[string]bool{}
+		cases             bytes.Buffer
+		parseCases        bytes.Buffer
+		parsed            = map[string]string{}
+		imports           []string
+	)
+
+	for _, v := range values {
+		str := strings.TrimPrefix(v.Name, e.TrimPrefix)
+		if str == "" {
+			str = v.Name
+		}
+		names = append(names, v.Name)
+
+		//Trimming the prefix can leave two constants with the same name, which would be duplicate cases
+		if other, found := parsed[str]; found {
+			return nil, fmt.Errorf("%s and %s would both be named %q, trim another prefix", other, v.Name, str)
+		}
+		parsed[str] = v.Name
+		fmt.Fprintf(&parseCases, "case %q:\nreturn %s, nil\n", str, v.Name)
+
+		//Constants with the same value would be duplicate cases, so the first one names the value
+		if !named[v.Value.ExactString()] {
+			named[v.Value.ExactString()] = true
+			fmt.Fprintf(&cases, "case %s:\nreturn %q\n", v.Name, str)
+		}
+	}
+
+	format := "strconv.FormatInt(int64(%s), 10)"
+	if unsigned {
+		format = "strconv.FormatUint(uint64(%s), 10)"
+	}
+
+	if !e.declares(name, "String") {
+		imports = append(imports, "strconv")
+		fmt.Fprintf(&decls, "\nfunc (%s %s) String() string {\nswitch %s {\n%s}\nreturn \"%s(\" + %s + \")\"\n}\n", rcvr, name, rcvr, cases.Bytes(), name, fmt.Sprintf(format, rcvr))
+	}
+	if _, exists := e.Package.LookupFunc(parse); !exists {
+		imports = append(imports, "fmt")
+		fmt.Fprintf(&decls, "\nfunc %s(name string) (%s, error) {\nswitch name {\n%s}\nreturn 0, fmt.Errorf(\"%%q is not a %s\", name)\n}\n", parse, name, parseCases.Bytes(), name)
+	}
+	if _, exists := e.Package.LookupFunc(valuesFunc); !exists {
+		fmt.Fprintf(&decls, "\nfunc %s() []%s {\nreturn []%s{%s}\n}\n", valuesFunc, name, name, strings.Join(names, ", "))
+	}
+	if !e.declares(name, "MarshalText") {
+		fmt.Fprintf(&decls, "\nfunc (%s %s) MarshalText() ([]byte, error) {\nreturn []byte(%s.String()), nil\n}\n", rcvr, name, rcvr)
+	}
+	if !e.declares(name, "UnmarshalText") {
+		fmt.Fprintf(&decls, "\nfunc (%s *%s) UnmarshalText(text []byte) error {\nparsed, err := %s(string(text))\nif err != nil {\nreturn err\n}\n*%s = parsed\nreturn nil\n}\n", rcvr, name, parse, rcvr)
+	}
+	if !e.declares(name, "MarshalJSON") {
+		imports = append(imports, "encoding/json")
+		fmt.Fprintf(&decls, "\nfunc (%s %s) MarshalJSON() ([]byte, error) {\nreturn json.Marshal(%s.String())\n}\n", rcvr, name, rcvr)
+	}
+	if !e.declares(name, "UnmarshalJSON") {
+		imports = append(imports, "encoding/json")
+		fmt.Fprintf(&decls, "\nfunc (%s *%s) UnmarshalJSON(data []byte) error {\nvar name string\nif err := json.Unmarshal(data, &name); err != nil {\nreturn err\n}\nreturn %s.UnmarshalText([]byte(name))\n}\n", rcvr, name, rcvr)
+	}
+
+	if decls.Len() == 0 {
+		return nil, nil
+	}
+	return generatedSource(e.Package, name, enumImports(imports), decls.Bytes())
+}
+
+func (e *Enumerator) declares(name, method string) bool {
+	_, exists := e.Package.LookupMethod(name, method)
+	return exists
+}
+
+//The imports of the packages the generated methods use
+func enumImports(paths []string) (imports ImportSpecs) {
+	for _, path := range paths {
+		imports = append(imports, &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)}})
+	}
+	return
+}
+
+//The constants of a file by the type they're declared as, in the order they're declared
+//Constants without a type or value repeat those of the one before, with the next value of iota
+//Types with a constant that can't be evaluated are failed, since an enum of them would be missing a value
+func enumValues(file *ast.File) (values map[string][]enumValue, failed map[string]error) {
+	values, failed = map[string][]enumValue{}, map[string]error{}
+	known := map[string]constant.Value{}
+
+	for _, decl := range file.Decls {
+		gen, isGen := decl.(*ast.GenDecl)
+		if !isGen || gen.Tok != token.CONST {
+			continue
+		}
+
+		var (
+			typ   ast.Expr
+			exprs []ast.Expr
+		)
+		for index, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			if len(vs.Values) != 0 {
+				typ, exprs = vs.Type, vs.Values
+			}
+
+			for i, id := range vs.Names {
+				if i >= len(exprs) {
+					break
+				}
+				v, err := evalConst(exprs[i], index, known)
+				t, isIdent := typ.(*ast.Ident)
+				//Untyped constants are still an enum's when they're converted to it, as in Red = Color(1)
+				if call, isCall := exprs[i].(*ast.CallExpr); typ == nil && isCall {
+					t, isIdent = call.Fun.(*ast.Ident)
+				}
+				if err != nil {
+					//Only the constants of enums have to be evaluated
+					if isIdent && failed[t.Name] == nil {
+						failed[t.Name] = fmt.Errorf("Cannot evaluate %s: %s", id.Name, err)
+					}
+					continue
+				}
+				known[id.Name] = v
+
+				if isIdent && v.Kind() != constant.Int && failed[t.Name] == nil {
+					failed[t.Name] = fmt.Errorf("%s isn't an integer", id.Name)
+				}
+
+				if isIdent && id.Name != "_" {
+					values[t.Name] = append(values[t.Name], enumValue{id.Name, v})
+				}
+			}
+		}
+	}
+	return
+}
+
+//Builtin functions that can be called in constant expressions
+var constBuiltins = []string{"len", "cap", "real", "imag", "complex", "min", "max"}
+
+//The value of a constant expression, as far as an enum's constants are written
+func evalConst(x ast.Expr, iota int, known map[string]constant.Value) (constant.Value, error) {
+	switch t := x.(type) {
+	case *ast.BasicLit:
+		if v := constant.MakeFromLiteral(t.Value, t.Kind, 0); v.Kind() != constant.Unknown {
+			return v, nil
+		}
+
+	case *ast.Ident:
+		if t.Name == "iota" {
+			return constant.MakeInt64(int64(iota)), nil
+		}
+		if v, found := known[t.Name]; found {
+			return v, nil
+		}
+
+	case *ast.ParenExpr:
+		return evalConst(t.X, iota, known)
+
+	case *ast.UnaryExpr:
+		v, err := evalConst(t.X, iota, known)
+		if err != nil {
+			return nil, err
+		}
+		return constant.UnaryOp(t.Op, v, 0), nil
+
+	case *ast.BinaryExpr:
+		x, err := evalConst(t.X, iota, known)
+		if err != nil {
+			return nil, err
+		}
+		y, err := evalConst(t.Y, iota, known)
+		if err != nil {
+			return nil, err
+		}
+		switch t.Op {
+		case token.SHL, token.SHR:
+			s, ok := constant.Uint64Val(y)
+			if !ok {
+				break
+			}
+			return constant.Shift(x, t.Op, uint(s)), nil
+		case token.QUO:
+			//Integer constants divide as integers
+			return constant.BinaryOp(x, token.QUO_ASSIGN, y), nil
+		default:
+			return constant.BinaryOp(x, t.Op, y), nil
+		}
+
+	case *ast.CallExpr:
+		//Conversions such as Color(1) keep the value, but calls of builtins such as len don't
+		if fun, isIdent := t.Fun.(*ast.Ident); isIdent && len(t.Args) == 1 && !containsString(constBuiltins, fun.Name) {
+			return evalConst(t.Args[0], iota, known)
+		}
+	}
+	return nil, fmt.Errorf("%s isn't a constant expression goast can evaluate", ExprString(x))
+}
+
+//Generate enum methods for the integer types of a spec file, written next to it
+func enum(specFile string, types []string, trimPrefix string, cfg writeConfig) {
+	fmt.Printf("Enum %s\n", specFile)
+	cfg.Types = types
+	transformSpec(specFile, "enum.go", cfg, func(pkg *Context, dir string) AstTransform {
+		return NewEnumerator(pkg, types, trimPrefix)
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const enumSpec = `package app
+
+type Color int
+
+const (
+	ColorRed Color = iota
+	ColorGreen
+	_
+	ColorBlue
+	ColorCrimson Color = ColorRed
+)
+
+type flag uint8
+
+const (
+	flagA flag = 1 << iota
+	flagB
+)
+
+func (f flag) String() string { return "" }
+
+type Size int
+
+const Huge = Size(10)
+`
+
+func Test_Enum(t *testing.T) {
+	sources := transformedSource(t, enumSpec, func(pkg *Context, dir string) AstTransform {
+		return NewEnumerator(pkg, nil, "Color")
+	})
+
+	tests := []struct {
+		Name           string
+		Expect, Reject []string
+	}{
+		{"Color", []string{
+			"import (\n\t\"encoding/json\"\n\t\"fmt\"\n\t\"strconv\"\n)",
+			"func (c Color) String() string {\n\tswitch c {\n\tcase ColorRed:\n\t\treturn \"Red\"\n\tcase ColorGreen:\n\t\treturn \"Green\"\n\tcase ColorBlue:\n\t\treturn \"Blue\"\n\t}\n\treturn \"Color(\" + strconv.FormatInt(int64(c), 10) + \")\"\n}",
+			"\tcase \"Crimson\":\n\t\treturn ColorCrimson, nil\n",
+			"func ColorValues() []Color {\n\treturn []Color{ColorRed, ColorGreen, ColorBlue, ColorCrimson}\n}",
+			"func (c *Color) UnmarshalText(text []byte) error {\n\tparsed, err := ParseColor(string(text))",
+			"func (c Color) MarshalJSON() ([]byte, error) {",
+		}, []string{"case ColorCrimson:"}},
+		{"flag", []string{
+			"import (\n\t\"encoding/json\"\n\t\"fmt\"\n)",
+			"func parseFlag(name string) (flag, error) {\n\tswitch name {\n\tcase \"flagA\":",
+			"func flagValues() []flag {",
+		}, []string{"String() string", "strconv"}},
+		{"Size", []string{"\tcase Huge:\n\t\treturn \"Huge\"\n"}, nil},
+	}
+
+	for _, tst := range tests {
+		src, found := sources[tst.Name]
+		if !found {
+			t.Errorf("Expected an enum for %s, found %v", tst.Name, sources)
+			continue
+		}
+		for _, expect := range tst.Expect {
+			if !strings.Contains(src, expect) {
+				t.Errorf("Expected the enum %s to contain\n%s\nfound\n%s", tst.Name, expect, src)
+			}
+		}
+		for _, reject := range tst.Reject {
+			if strings.Contains(src, reject) {
+				t.Errorf("Expected the enum %s not to contain %s, found\n%s", tst.Name, reject, src)
+			}
+		}
+	}
+}
+
+func Test_EnumValues(t *testing.T) {
+	tests := []struct {
+		Source string
+		Expect map[string]string
+		Failed string
+	}{
+		{"const (\n\tA T = iota * 10\n\tB\n\tC, D T = iota + 1, iota - 1\n)", map[string]string{"A": "0", "B": "10", "C": "3", "D": "1"}, ""},
+		{"const (\n\tKB T = 1 << (10 * (iota + 1))\n\tMB\n)\nconst Half = T(MB / 2)", map[string]string{"KB": "1024", "MB": "1048576", "Half": "524288"}, ""},
+		{"const (\n\tA T = 'a'\n\tB T = -A\n)", map[string]string{"A": "97", "B": "-97"}, ""},
+		{"const (\n\tA T = 1.5\n)", map[string]string{"A": "3/2"}, "A isn't an integer"},
+		{"const (\n\tA T = len(\"a\")\n)", map[string]string{}, "Cannot evaluate A"},
+	}
+
+	for _, tst := range tests {
+		file, err := parser.ParseFile(token.NewFileSet(), "enum.go", "package app\n\ntype T int\n\n"+tst.Source, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values, failed := enumValues(file)
+
+		found := map[string]string{}
+		for _, v := range values["T"] {
+			found[v.Name] = v.Value.ExactString()
+		}
+		if len(found) != len(tst.Expect) {
+			t.Errorf("Expected %v, found %v", tst.Expect, found)
+		}
+		for name, value := range tst.Expect {
+			if found[name] != value {
+				t.Errorf("Expected %s to be %s, found %s", name, value, found[name])
+			}
+		}
+		if err := failed["T"]; (err == nil) != (tst.Failed == "") || (err != nil && !strings.Contains(err.Error(), tst.Failed)) {
+			t.Errorf("Expected failure %q, found %v", tst.Failed, err)
+		}
+	}
+}
+
+func Test_EnumParseClash(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+	writeTestFiles(dir, map[string]string{"app/app.go": "package app\n\ntype Color int\n\nconst (\n\tColorRed Color = iota\n\tRed\n)\n"})
+	specFile := filepath.Join(dir, "app", "app.go")
+
+	spec, _ := NewFileContext(specFile)
+	pkg, _ := NewPackageContext(specFile, func(string) bool { return false })
+	_, ok, errors := NewEnumerator(pkg, nil, "Color").Transform(spec)
+	if expect := `ColorRed and Red would both be named "Red"`; ok || len(errors) != 1 || !strings.Contains(errors[0].Error(), expect) {
+		t.Errorf("Expected an error containing %q, found %v", expect, errors)
+	}
+}
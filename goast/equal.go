@@ -0,0 +1,233 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+//Generates Equal methods that compare spec types deeply, e.g. for
+//	type Config struct{ Tags []string; Parent *Config }
+//Config gets Equal(other Config) bool, which compares the Tags element by element and calls Equal on Parent
+//Values are equal under the same rules as reflect.DeepEqual, but the comparison is spelt out for each type
+//Interfaces are compared with reflect.DeepEqual, and fields tagged goast:"-" are ignored
+type Equaler struct {
+	structural
+}
+
+func NewEqualer(pkg *Context, dir string, types []string, cycles bool) *Equaler {
+	return &Equaler{newStructural(pkg, dir, types, cycles)}
+}
+
+func (e *Equaler) Transform(spec *Context) (codes SourceSet, ok bool, errors []error) {
+	specs, errors := e.specTypes(spec, "Equal")
+	for _, t := range specs {
+		source, err := e.equal(t)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("Cannot generate Equal for %s: %s", t.Name.Name, err))
+			continue
+		}
+		codes = append(codes, source)
+	}
+
+	if len(codes) == 0 && len(errors) == 0 {
+		errors = append(errors, fmt.Errorf("No type in %s to generate Equal for", spec.File.Name.Name))
+	}
+	ok = len(errors) == 0
+	return
+}
+
+func (e *Equaler) equal(t *ast.TypeSpec) (*SourceCode, error) {
+	e.reset()
+	var (
+		name          = t.Name.Name
+		rcvr, pointer = receiverOf(e.Package, name)
+		recvType, a   = name, rcvr
+		other         = "other"
+		body          bytes.Buffer
+		decls         bytes.Buffer
+	)
+	if pointer {
+		recvType, a = "*"+name, "(*"+rcvr+")"
+	}
+	if rcvr == other {
+		other = "o"
+	}
+
+	if e.flat(t.Type, "Equal") {
+		fmt.Fprintf(&body, "return %s == %s\n", unparen(a), other)
+	} else {
+		if err := e.equalExpr(&body, a, other, t.Type); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&body, "return true\n")
+	}
+
+	if e.Cycles {
+		fmt.Fprintf(&decls, "\nfunc (%s %s) Equal(%s %s) bool {\n\treturn %s.equalVisited(%s, map[[2]interface{}]bool{})\n}\n", rcvr, recvType, other, name, rcvr, other)
+		fmt.Fprintf(&decls, "\nfunc (%s %s) equalVisited(%s %s, visited map[[2]interface{}]bool) bool {\n%s}\n", rcvr, recvType, other, name, body.Bytes())
+	} else {
+		fmt.Fprintf(&decls, "\nfunc (%s %s) Equal(%s %s) bool {\n%s}\n", rcvr, recvType, other, name, body.Bytes())
+	}
+	return generatedSource(e.Package, name, e.imports, decls.Bytes())
+}
+
+//Statements that return false unless a and b are deeply equal, where x is the declaration of their type
+func (e *Equaler) equalExpr(w *bytes.Buffer, a, b string, x ast.Expr) error {
+	if e.flat(x, "Equal") {
+		fmt.Fprintf(w, "if %s != %s {\nreturn false\n}\n", unparen(a), unparen(b))
+		return nil
+	}
+
+	// *Ident, *ParenExpr, *SelectorExpr, *StarExpr, or any of the *XxxTypes
+	switch t := x.(type) {
+	case *ast.ParenExpr:
+		return e.equalExpr(w, a, b, t.X)
+
+	case *ast.Ident:
+		if e.Cycles && e.selected[t.Name] {
+			fmt.Fprintf(w, "if !%s(%s, visited) {\nreturn false\n}\n", selector(a, "equalVisited"), unparen(b))
+			return nil
+		}
+		if e.callsMethod(t, "Equal") {
+			fmt.Fprintf(w, "if !%s(%s) {\nreturn false\n}\n", selector(a, "Equal"), unparen(b))
+			return nil
+		}
+
+		decl, predeclared, err := e.expand(t, "Equal")
+		if predeclared && isPredeclaredInterface(t) {
+			e.deepEqual(w, a, b)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		e.expanding[t.Name] = true
+		defer delete(e.expanding, t.Name)
+		return e.equalExpr(w, a, b, decl)
+
+	case *ast.SelectorExpr:
+		//Types of other packages that are only held back from == by their interfaces
+		if !e.hasMethod(t, "Equal") && e.comparedDeeply(t) {
+			e.deepEqual(w, a, b)
+			return nil
+		}
+		if !e.hasMethod(t, "Equal") {
+			return fmt.Errorf("Cannot compare %s, it isn't comparable and has no Equal method. Tag the field goast:\"-\" to ignore it", ExprString(t))
+		}
+		fmt.Fprintf(w, "if !%s(%s) {\nreturn false\n}\n", selector(a, "Equal"), unparen(b))
+
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		inst, ok := e.Package.Instantiate(t)
+		if !ok {
+			return fmt.Errorf("Cannot compare %s, its declaration can't be instantiated", ExprString(t))
+		}
+		return e.equalExpr(w, a, b, inst)
+
+	case *ast.StarExpr:
+		fmt.Fprintf(w, "if (%s == nil) != (%s == nil) {\nreturn false\n}\n", a, b)
+		if e.Cycles {
+			pair := fmt.Sprintf("[2]interface{}{%s, %s}", a, b)
+			fmt.Fprintf(w, "if %s != nil && %s != %s && !visited[%s] {\nvisited[%s] = true\n", a, a, b, pair, pair)
+		} else {
+			fmt.Fprintf(w, "if %s != nil && %s != %s {\n", a, a, b)
+		}
+		if err := e.equalExpr(w, "(*"+a+")", "(*"+b+")", t.X); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "}\n")
+
+	case *ast.ArrayType:
+		if t.Len == nil {
+			fmt.Fprintf(w, "if len(%s) != len(%s) || (%s == nil) != (%s == nil) {\nreturn false\n}\n", a, b, a, b)
+		}
+		i := e.newVar("i")
+		fmt.Fprintf(w, "for %s := range %s {\n", i, a)
+		if err := e.equalExpr(w, a+"["+i+"]", b+"["+i+"]", t.Elt); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "}\n")
+
+	case *ast.MapType:
+		k, va, vb := e.newVar("k"), e.newVar("v"), e.newVar("v")
+		fmt.Fprintf(w, "if len(%s) != len(%s) || (%s == nil) != (%s == nil) {\nreturn false\n}\n", a, b, a, b)
+		fmt.Fprintf(w, "for %s, %s := range %s {\n%s, found := %s[%s]\nif !found {\nreturn false\n}\n", k, va, a, vb, b, k)
+		if err := e.equalExpr(w, va, vb, t.Value); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "}\n")
+
+	case *ast.InterfaceType:
+		e.deepEqual(w, a, b)
+
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if optedOut(field) {
+				continue
+			}
+			names := fieldNames(field)
+			if len(names) == 0 {
+				return fmt.Errorf("Cannot compare the embedded field %s", ExprString(field.Type))
+			}
+			for _, name := range names {
+				if name == "_" {
+					continue
+				}
+				if err := e.equalExpr(w, selector(a, name), selector(b, name), field.Type); err != nil {
+					return err
+				}
+			}
+		}
+
+	case *ast.FuncType:
+		//Like reflect.DeepEqual, funcs are only equal when they're both nil
+		fmt.Fprintf(w, "if %s != nil || %s != nil {\nreturn false\n}\n", a, b)
+
+	default:
+		return fmt.Errorf("Cannot compare %s", ExprString(x))
+	}
+	return nil
+}
+
+//Generate Equal methods for the types of a spec file, written next to it
+func equal(specFile string, types []string, cycles bool, cfg writeConfig) {
+	fmt.Printf("Equal %s\n", specFile)
+	cfg.Types = types
+	transformSpec(specFile, "equal.go", cfg, func(pkg *Context, dir string) AstTransform {
+		return NewEqualer(pkg, dir, types, cycles)
+	})
+}
+
+//Compare values whose dynamic types are only known at run time, which == may panic on
+func (e *Equaler) deepEqual(w *bytes.Buffer, a, b string) {
+	e.imports = append(e.imports, &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: `"reflect"`}})
+	fmt.Fprintf(w, "if !reflect.DeepEqual(%s, %s) {\nreturn false\n}\n", unparen(a), unparen(b))
+}
+
+//Whether a type of another package holds interfaces, but would otherwise be compared with ==
+func (e *Equaler) comparedDeeply(sel *ast.SelectorExpr) bool {
+	pkg, _, err := e.importedPackage(e.Package, sel)
+	if err != nil {
+		return false
+	}
+	foreign := ast.NewIdent(sel.Sel.Name)
+	return e.foreignInterfaces(pkg, foreign, map[*ast.TypeSpec]bool{}) && e.foreignFlat(pkg, foreign, "Equal", map[*ast.TypeSpec]bool{})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_Equal(t *testing.T) {
+	tests := []struct {
+		Types          []string
+		Cycles         bool
+		Name           string
+		Expect, Reject []string
+	}{
+		{nil, false, "Tags", []string{
+			"func (t Tags) Equal(other Tags) bool {\n\tif len(t) != len(other) || (t == nil) != (other == nil) {\n\t\treturn false\n\t}\n\tfor i0 := range t {\n\t\tif t[i0] != other[i0] {\n\t\t\treturn false\n\t\t}\n\t}\n\treturn true\n}",
+		}, nil},
+		{nil, false, "Point", []string{"func (p Point) Equal(other Point) bool {\n\treturn p == other\n}"}, nil},
+		{[]string{"Node", "Tags"}, false, "Node", []string{
+			"func (n *Node) Equal(other Node) bool {",
+			"\tif !n.Tags.Equal(other.Tags) {\n\t\treturn false\n\t}",
+			"\tif (n.Next == nil) != (other.Next == nil) {\n\t\treturn false\n\t}\n\tif n.Next != nil && n.Next != other.Next {\n\t\tif !n.Next.Equal(*other.Next) {\n\t\t\treturn false\n\t\t}\n\t}",
+			"\tfor k3, v4 := range n.Attrs {\n\t\tv5, found := other.Attrs[k3]\n\t\tif !found {\n\t\t\treturn false\n\t\t}\n\t\tif (v4 == nil) != (v5 == nil) {",
+			"\t\t\tif *v4 != *v5 {",
+			"\tif !n.Started.Equal(other.Started) {\n\t\treturn false\n\t}",
+			"\tif n.OnDone != nil || other.OnDone != nil {\n\t\treturn false\n\t}",
+		}, []string{"mu", "reflect", "import"}},
+		{[]string{"Node", "Tags"}, true, "Node", []string{
+			"func (n *Node) Equal(other Node) bool {\n\treturn n.equalVisited(other, map[[2]interface{}]bool{})\n}",
+			"\tif n.Next != nil && n.Next != other.Next && !visited[[2]interface{}{n.Next, other.Next}] {\n\t\tvisited[[2]interface{}{n.Next, other.Next}] = true\n\t\tif !n.Next.equalVisited(*other.Next, visited) {",
+		}, nil},
+	}
+
+	for _, tst := range tests {
+		sources := transformedSource(t, structuralSpec, func(pkg *Context, dir string) AstTransform {
+			return NewEqualer(pkg, dir, tst.Types, tst.Cycles)
+		})
+		src, found := sources[tst.Name]
+		if !found {
+			t.Errorf("Expected Equal for %s, found %v", tst.Name, sources)
+			continue
+		}
+		for _, expect := range tst.Expect {
+			if !strings.Contains(src, expect) {
+				t.Errorf("Expected Equal of %s to contain\n%s\nfound\n%s", tst.Name, expect, src)
+			}
+		}
+		for _, reject := range tst.Reject {
+			if strings.Contains(src, reject) {
+				t.Errorf("Expected Equal of %s not to contain %s, found\n%s", tst.Name, reject, src)
+			}
+		}
+	}
+}
+
+func Test_EqualForeignTypes(t *testing.T) {
+	const imports = "package app\n\nimport (\n\t\"bytes\"\n\t\"image\"\n)\n\n"
+
+	//Types of other packages are compared with == when all they hold directly can be
+	sources := transformedSource(t, imports+"var _ bytes.Buffer\n\ntype Shape struct{ Min image.Point }\n", func(pkg *Context, dir string) AstTransform {
+		return NewEqualer(pkg, dir, []string{"Shape"}, false)
+	})
+	if expect := "return s == other"; !strings.Contains(sources["Shape"], expect) {
+		t.Errorf("Expected Equal of Shape to contain %q, found\n%s", expect, sources["Shape"])
+	}
+
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+	specFile := filepath.Join(dir, "app", "app.go")
+	writeTestFiles(dir, map[string]string{"app/app.go": imports + "var _ image.Point\n\ntype Request struct{ Body bytes.Buffer }\n"})
+
+	spec, _ := NewFileContext(specFile)
+	pkg, _ := NewPackageContext(specFile, func(string) bool { return false })
+	_, ok, errors := NewEqualer(pkg, filepath.Dir(specFile), nil, false).Transform(spec)
+	if expect := "Cannot compare bytes.Buffer"; ok || len(errors) == 0 || !strings.Contains(errors[0].Error(), expect) {
+		t.Errorf("Expected an error containing %q, found %v", expect, errors)
+	}
+}
+
+func Test_EqualInterfaces(t *testing.T) {
+	const spec = `package app
+
+import (
+	"image"
+	"io"
+)
+
+type Meta interface{ Name() string }
+
+type Event struct {
+	Err     error
+	Payload any
+	Src     io.Reader
+	Meta    Meta
+	Fill    image.Uniform
+	N       int
+}
+`
+
+	//== panics on dynamic values that can't be compared, such as slices, so interfaces are compared deeply
+	sources := transformedSource(t, spec, func(pkg *Context, dir string) AstTransform {
+		return NewEqualer(pkg, dir, []string{"Event"}, false)
+	})
+	src := sources["Event"]
+	for _, expect := range []string{
+		"import \"reflect\"",
+		"\tif !reflect.DeepEqual(e.Err, other.Err) {\n\t\treturn false\n\t}",
+		"\tif !reflect.DeepEqual(e.Payload, other.Payload) {",
+		"\tif !reflect.DeepEqual(e.Src, other.Src) {",
+		"\tif !reflect.DeepEqual(e.Meta, other.Meta) {",
+		"\tif !reflect.DeepEqual(e.Fill, other.Fill) {",
+		"\tif e.N != other.N {",
+	} {
+		if !strings.Contains(src, expect) {
+			t.Errorf("Expected Equal of Event to contain %q, found\n%s", expect, src)
+		}
+	}
+	if strings.Contains(src, "e == other") {
+		t.Errorf("Expected Event not to be compared whole, found\n%s", src)
+	}
+}
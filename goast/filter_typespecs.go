@@ -26,9 +26,28 @@ import (
 //This is a known issue and the suggestion is to roll your own
 //See: https://github.com/golang/go/issues/9248
 func filterTypeSpecs(file *ast.File, fn func(*ast.TypeSpec) bool) {
+	filterSpecs(file, func(s ast.Spec) bool {
+		if t, ok := s.(*ast.TypeSpec); ok {
+			return fn(t)
+		}
+		return true
+	})
+}
+
+//Filters out top level const and var declarations out of an ast
+func filterValueSpecs(file *ast.File, fn func(*ast.ValueSpec) bool) {
+	filterSpecs(file, func(s ast.Spec) bool {
+		if v, ok := s.(*ast.ValueSpec); ok {
+			return fn(v)
+		}
+		return true
+	})
+}
+
+func filterSpecs(file *ast.File, fn func(ast.Spec) bool) {
 	i := 0
 	for _, d := range file.Decls {
-		if filterNodeForTypeSpec(d, fn) {
+		if filterDeclForSpec(d, fn) {
 			file.Decls[i] = d
 			i++
 		}
@@ -36,24 +55,21 @@ func filterTypeSpecs(file *ast.File, fn func(*ast.TypeSpec) bool) {
 	file.Decls = file.Decls[0:i]
 }
 
-func filterNodeForTypeSpec(node ast.Node, fn func(*ast.TypeSpec) bool) bool {
+func filterDeclForSpec(node ast.Decl, fn func(ast.Spec) bool) bool {
 	switch t := node.(type) {
 	case *ast.GenDecl:
-		t.Specs = filterSpecsForTypeSpec(t.Specs, fn)
+		t.Specs = filterSpecList(t.Specs, fn)
 		return len(t.Specs) > 0
 
-	case *ast.TypeSpec:
-		return fn(t)
-
 	default:
 		return true
 	}
 }
 
-func filterSpecsForTypeSpec(specs []ast.Spec, fn func(*ast.TypeSpec) bool) []ast.Spec {
+func filterSpecList(specs []ast.Spec, fn func(ast.Spec) bool) []ast.Spec {
 	i := 0
 	for _, s := range specs {
-		if filterNodeForTypeSpec(s, fn) {
+		if fn(s) {
 			specs[i] = s
 			i++
 		}
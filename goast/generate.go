@@ -0,0 +1,452 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//A project configuration file listing every implementation to generate, e.g. goast.json
+//	{
+//		"jobs": [
+//			{"generic": "goast.net/x/iter", "spec": "users/users.go", "prefix": "gen_"},
+//			{"generic": "goast.net/x/sort", "spec": "users/users.go", "bindings": {"T": "*User"}, "out": "users/sorted"}
+//		]
+//	}
+type generateConfig struct {
+	Jobs []generateJob `json:"jobs"`
+}
+
+//Each job is the equivalent of a goast write impl directive
+//Spec files and output directories are relative to the configuration file
+type generateJob struct {
+	//Generic file or package to implement
+	Generic string `json:"generic"`
+	//Spec file that provides types to the generic
+	Spec string `json:"spec"`
+	//Types that generic types must be implemented by, e.g. {"T": "int"}
+	Bindings map[string]string `json:"bindings,omitempty"`
+	//Spec types to implement the generic for. Defaults to every type in the spec file
+	Types  []string `json:"types,omitempty"`
+	Prefix string   `json:"prefix,omitempty"`
+	Suffix string   `json:"suffix,omitempty"`
+	//Directory generated files are written to. Defaults to the spec file's directory
+	Out string `json:"out,omitempty"`
+	//Package generated into another directory belongs to. Defaults to the package already there, or the directory's name
+	Package string `json:"package,omitempty"`
+	//How methods on spec types are generated into another package: wrapper (the default) or func
+	Form string `json:"form,omitempty"`
+	//Merge every implementation the job generates into one file of this name, instead of a file per spec type
+	SingleFile string `json:"single_file,omitempty"`
+	//Where spec types are drawn from: the spec file (the default) or every file in its package
+	SpecScope string `json:"spec_scope,omitempty"`
+	//Receivers of the methods generated on spec types: pointer, value or match. Defaults to the generic's goast:receivers directive
+	Receivers string `json:"receivers,omitempty"`
+	//Implement spec aliases of types that can't have methods, such as types of other packages, with wrapper types
+	WrapAliases bool `json:"wrap_aliases,omitempty"`
+
+	//What asked for the job: go:generate, annotation, or the path of a configuration file
+	Directive string `json:"-"`
+}
+
+func (job generateJob) config() writeConfig {
+	return writeConfig{job.Prefix, job.Suffix, job.Bindings, job.Types, job.Package, job.Form, job.SingleFile, job.SpecScope, job.Receivers, job.WrapAliases}
+}
+
+//Spec scopes, see generateJob
+const (
+	fileScope    = "file"
+	packageScope = "package"
+)
+
+func loadGenerateConfig(path string) (cfg generateConfig, err error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(b, &cfg); err != nil {
+		err = fmt.Errorf("Invalid configuration %s: %s", path, err)
+		return
+	}
+
+	for i, job := range cfg.Jobs {
+		if job.Generic == "" || job.Spec == "" {
+			err = fmt.Errorf("Invalid configuration %s: job %d needs both a generic and a spec", path, i+1)
+			return
+		}
+	}
+	return
+}
+
+//Runs generate jobs in a single process. Spec files, generic paths and generic files are each only parsed
+//or resolved once, no matter how many jobs share them
+type generator struct {
+	Root  string
+	Cache *generationCache
+
+	specs    map[string]*Context
+	generics map[string][]string
+	parsed   map[string]*Context
+	//The generics each generic file depends on, see genericDependencies
+	dependencyCache map[string][]string
+	//Generics being run, so generics that depend on each other are only run once, see Dependencies
+	running map[string]bool
+}
+
+func newGenerator(root string, cache *generationCache) *generator {
+	return &generator{
+		Root:     root,
+		Cache:    cache,
+		specs:    map[string]*Context{},
+		generics: map[string][]string{},
+		parsed:   map[string]*Context{},
+		running:  map[string]bool{},
+
+		dependencyCache: map[string][]string{},
+	}
+}
+
+func (g *generator) path(p string) string {
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+	return filepath.Join(g.Root, p)
+}
+
+func (g *generator) spec(specFile, scope string) (ctx *Context, err error) {
+	if ctx, found := g.specs[scope+" "+specFile]; found {
+		return ctx, nil
+	}
+
+	switch scope {
+	case "", fileScope:
+		ctx, err = NewFilePackageContext(specFile)
+	case packageScope:
+		ctx, err = NewPackageContext(specFile, generatedIn(filepath.Dir(specFile)))
+	default:
+		err = fmt.Errorf("Invalid spec scope %s, expected %s or %s", scope, fileScope, packageScope)
+	}
+	if err == nil && ctx == nil {
+		err = fmt.Errorf("Cannot find spec file %s", specFile)
+	}
+	if err != nil {
+		return
+	}
+	g.specs[scope+" "+specFile] = ctx
+	return
+}
+
+func (g *generator) genericFiles(genericPath string) (files []string, err error) {
+	if strings.HasSuffix(genericPath, ".go") {
+		genericPath = g.path(genericPath)
+	}
+
+	if files, found := g.generics[genericPath]; found {
+		return files, nil
+	}
+
+	if files, err = targetGenericSource(genericPath); err != nil {
+		return
+	}
+
+	//What goast generated into a generic package from other generics is generated for spec types from those generics directly
+	if !strings.HasSuffix(genericPath, ".go") {
+		var generated func(string) bool
+		sources := []string{}
+		for _, file := range files {
+			if generated == nil {
+				generated = generatedIn(filepath.Dir(file))
+			}
+			if !generated(filepath.Base(file)) {
+				sources = append(sources, file)
+			}
+		}
+		files = sources
+	}
+	g.generics[genericPath] = files
+	return
+}
+
+func (g *generator) generic(genericFile string) (ctx *Context, err error) {
+	if ctx, found := g.parsed[genericFile]; found {
+		return ctx, nil
+	}
+
+	if ctx, err = NewFileContext(genericFile); err != nil {
+		return
+	}
+	g.parsed[genericFile] = ctx
+	return
+}
+
+//A hash of everything the output of a job depends on, see generationKey
+func (g *generator) Key(job generateJob) (key string, err error) {
+	spec, err := g.spec(g.path(job.Spec), job.SpecScope)
+	if err != nil {
+		return
+	}
+
+	files, err := g.genericFiles(job.Generic)
+	if err != nil {
+		return
+	}
+
+	specFile := relativeTo(g.outputDirectory(job), g.path(job.Spec))
+	h := sha256.New()
+	for _, genericFile := range files {
+		fileKey, err := generationKey(genericFile, specFile, spec, job.config())
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintln(h, fileKey)
+	}
+	key = hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+//Jobs write next to their spec file unless given another directory
+func (g *generator) outputDirectory(job generateJob) string {
+	if job.Out != "" {
+		return g.path(job.Out)
+	}
+	return filepath.Dir(g.path(job.Spec))
+}
+
+//The implementor for a job, along with the generic files it implements and where they are written
+func (g *generator) prepare(job generateJob) (imp *Implementor, files []string, outputDirectory string, err error) {
+	specFile := g.path(job.Spec)
+	spec, err := g.spec(specFile, job.SpecScope)
+	if err != nil {
+		return
+	}
+
+	imp = NewImplementor(spec)
+	imp.Targets = job.Types
+	imp.WrapAliases = job.WrapAliases
+	imp.Dir = filepath.Dir(specFile)
+	if err = validReceivers(job.Receivers); err != nil {
+		return
+	}
+	for name, binding := range job.Bindings {
+		x, parseErr := parser.ParseExpr(binding)
+		if parseErr != nil {
+			err = fmt.Errorf("Invalid binding %s: %s", name, binding)
+			return
+		}
+		imp.Bindings.Store(name, x)
+	}
+
+	if files, err = g.genericFiles(job.Generic); err != nil {
+		return
+	}
+
+	outputDirectory = g.outputDirectory(job)
+	if absPath(outputDirectory) == absPath(filepath.Dir(specFile)) {
+		if job.Package != "" && job.Package != spec.File.Name.Name {
+			err = fmt.Errorf("Cannot generate package %s into the directory of package %s", job.Package, spec.File.Name.Name)
+		}
+		return
+	}
+
+	imp.Output = &outputPackage{Name: job.Package, Form: job.Form}
+	if imp.Output.Name == "" {
+		imp.Output.Name = packageNameOf(outputDirectory)
+	}
+	imp.Output.SpecPath, err = importPathOf(filepath.Dir(specFile))
+	return
+}
+
+//Files shared by the generic files of a job, such as alias wrappers, are only written once
+func appendSources(sources []cachedSource, add ...cachedSource) []cachedSource {
+	for _, s := range add {
+		duplicate := false
+		for _, existing := range sources {
+			duplicate = duplicate || existing.Name == s.Name
+		}
+		if !duplicate {
+			sources = append(sources, s)
+		}
+	}
+	return sources
+}
+
+//Implement the generic of a job on its spec file, writing the results to the job's output directory
+//Files the job produced last time but no longer does are removed, see manifest
+func (g *generator) Run(job generateJob) (errors []error) {
+	imp, files, outputDirectory, err := g.prepare(job)
+	if err != nil {
+		return []error{err}
+	}
+
+	//Generics this one builds on are implemented first, unless they're already being implemented
+	g.running[job.Generic] = true
+	defer delete(g.running, job.Generic)
+	deps, err := g.dependencies(job, imp, files)
+	if err != nil {
+		return []error{err}
+	}
+	for _, dep := range deps {
+		if g.running[dep.Generic] {
+			continue
+		}
+		fmt.Printf("Implement %s on %s for %s\n", dep.Generic, dep.Spec, job.Generic)
+		if errs := g.Run(dep); len(errs) != 0 {
+			return errs
+		}
+	}
+
+	//Generated code depends on the package it's generated into, even when it was left to default
+	cfg := job.config()
+	if imp.Output != nil {
+		cfg.Package = imp.Output.Name
+	}
+
+	specFile := relativeTo(outputDirectory, g.path(job.Spec))
+	sources := []cachedSource{}
+	for _, genericFile := range files {
+		var key string
+		if g.Cache != nil {
+			cached, hit := []cachedSource{}, false
+			if key, cached, hit = g.Cache.Lookup(genericFile, specFile, imp.TypeProvider, cfg); hit {
+				sources = appendSources(sources, cached...)
+				continue
+			}
+		}
+
+		gen, err := g.generic(genericFile)
+		if err == nil {
+			imp.Receivers, err = receiverPolicy(job, genericFile)
+		}
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+
+		generated := cachedSourcesOf(transformContext(gen, genericFile, imp, cfg))
+		sources = appendSources(sources, generated...)
+		if key == "" || len(generated) == 0 {
+			continue
+		}
+
+		if err := g.Cache.Store(key, generated); err != nil {
+			g.Cache.logf("Failed to cache %s: %s\n", genericFile, err)
+		}
+	}
+
+	for _, warning := range imp.warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+
+	if job.SingleFile != "" && len(sources) > 0 {
+		merged, err := mergeSources(singleFileName(job.SingleFile), sources)
+		if err != nil {
+			return append(errors, err)
+		}
+		sources = []cachedSource{merged}
+	}
+
+	written := []string{}
+	if err := os.MkdirAll(outputDirectory, 0755); err != nil {
+		return append(errors, err)
+	}
+	for _, s := range sources {
+		if err := ioutil.WriteFile(filepath.Join(outputDirectory, s.Name), s.Source, 0644); err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		written = append(written, s.Name)
+	}
+
+	//Without every generic file, it can't be told which outputs are stale
+	if len(errors) == 0 {
+		errors = g.record(job, outputDirectory, written)
+	}
+	return
+}
+
+//The names of the files a job would write, without writing anything
+func (g *generator) Outputs(job generateJob) (outputDirectory string, names []string, err error) {
+	imp, files, outputDirectory, err := g.prepare(job)
+	if err != nil {
+		return
+	}
+
+	for _, genericFile := range files {
+		gen, genErr := g.generic(genericFile)
+		if genErr == nil {
+			imp.Receivers, genErr = receiverPolicy(job, genericFile)
+		}
+		if genErr != nil {
+			err = genErr
+			return
+		}
+
+		codes, _, _ := imp.Transform(gen)
+		for _, code := range codes {
+			names = append(names, generatedFileName(job.config(), code.Name, genericFile))
+		}
+	}
+
+	if job.SingleFile != "" && len(names) > 0 {
+		names = []string{singleFileName(job.SingleFile)}
+	}
+	return
+}
+
+//The jobs in a configuration file, or every //goast:impl annotation in a package pattern such as ./...
+//Paths in jobs are relative to root
+func generateJobs(target string) (root string, jobs []generateJob, errors []error) {
+	if !strings.HasSuffix(target, ".json") {
+		jobs, errors = discoverJobs(target)
+		root = "."
+		return
+	}
+
+	cfg, err := loadGenerateConfig(target)
+	if err != nil {
+		errors = append(errors, err)
+		return
+	}
+	root, jobs = filepath.Dir(target), cfg.Jobs
+	for i := range jobs {
+		jobs[i].Directive = target
+	}
+	return
+}
+
+//Run every job in a configuration file, or every //goast:impl annotation in a package pattern
+//Paths in a configuration file are relative to the file's directory
+func generate(target string, cache *generationCache) {
+	root, jobs, errors := generateJobs(target)
+	printErrors(errors)
+
+	g := newGenerator(root, cache)
+	for _, job := range jobs {
+		fmt.Printf("Implement %s on %s\n", job.Generic, job.Spec)
+		printErrors(g.Run(job))
+	}
+}
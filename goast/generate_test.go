@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func Test_Generate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "gen"), 0755)
+	os.MkdirAll(filepath.Join(dir, "app"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "gen", "slice.go"), []byte(`package gen
+type T interface{}
+type Slice []T
+func (s Slice) First() T { return s[0] }`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "app", "main.go"), []byte(`package main
+type Ints []int
+type Names []string`), 0644)
+
+	config := filepath.Join(dir, "goast.json")
+	ioutil.WriteFile(config, []byte(`{"jobs": [
+		{"generic": "gen/slice.go", "spec": "app/main.go", "bindings": {"T": "int"}},
+		{"generic": "gen/slice.go", "spec": "app/main.go", "prefix": "all_", "out": "app"}
+	]}`), 0644)
+
+	generate(config, nil)
+
+	expect := map[string]string{
+		"ints_slice.go":      "func (s Ints) First() int",
+		"all_ints_slice.go":  "func (s Ints) First() int",
+		"all_names_slice.go": "func (s Names) First() string",
+	}
+	for name, src := range expect {
+		b, err := ioutil.ReadFile(filepath.Join(dir, "app", name))
+		if err != nil || !strings.Contains(string(b), src) {
+			t.Errorf("Expected %s to contain %q, found %q %v", name, src, b, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "app", "names_slice.go")); err == nil {
+		t.Error("Expected the T binding to rule out Names")
+	}
+}
+
+func Test_LoadGenerateConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		Config string
+		Valid  bool
+	}{
+		{`{"jobs": [{"generic": "goast.net/x/iter", "spec": "main.go"}]}`, true},
+		{`{"jobs": [{"generic": "goast.net/x/iter"}]}`, false},
+		{`{"jobs": [`, false},
+	}
+
+	for _, tst := range tests {
+		config := filepath.Join(dir, "goast.json")
+		ioutil.WriteFile(config, []byte(tst.Config), 0644)
+		if _, err := loadGenerateConfig(config); (err == nil) != tst.Valid {
+			t.Errorf("Expected valid %v for %s, found %v", tst.Valid, tst.Config, err)
+		}
+	}
+}
+
+func Test_GenerateSpecScope(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	writeTestFiles(dir, map[string]string{
+		"gen/slice.go":    manifestGeneric,
+		"app/gen.go":      "package main",
+		"app/models.go":   "package main\nimport \"time\"\ntype Times []time.Time",
+		"app/names.go":    "package main\ntype Names []string",
+		"app/app_test.go": "package main\ntype Tests []bool",
+		"file.json":       `{"jobs": [{"generic": "gen/slice.go", "spec": "app/gen.go"}]}`,
+		"package.json":    `{"jobs": [{"generic": "gen/slice.go", "spec": "app/gen.go", "spec_scope": "package"}]}`,
+	})
+
+	generate(filepath.Join(dir, "file.json"), nil)
+	if fileExists(filepath.Join(dir, "app", "times_slice.go")) {
+		t.Fatal("Expected file scope to only implement types in the spec file")
+	}
+
+	//Running again shows files generated into the package aren't mistaken for spec types
+	for i := 0; i < 2; i++ {
+		generate(filepath.Join(dir, "package.json"), nil)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "app", "times_slice.go"))
+	if err != nil || !strings.Contains(string(b), `import "time"`) || !strings.Contains(string(b), "func (s Times) First() time.Time") {
+		t.Errorf("Expected an implementation for a type in a sibling file, found %s %v", b, err)
+	}
+
+	m, _ := loadManifest(filepath.Join(dir, "app"))
+	if len(m.Entries) == 1 {
+		sort.Strings(m.Entries[0].Files)
+	}
+	if len(m.Entries) != 1 || !reflect.DeepEqual(m.Entries[0].Files, []string{"names_slice.go", "times_slice.go"}) {
+		t.Errorf("Expected implementations of every non-test type in the package, found %+v", m.Entries)
+	}
+}
+
+func Test_GenerateWriteErrors(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	writeTestFiles(dir, map[string]string{
+		"gen/slice.go": manifestGeneric,
+		"app/main.go":  "package main\ntype Ints []int",
+	})
+	//A directory in the way of the output can't be written over
+	os.Mkdir(filepath.Join(dir, "app", "ints_slice.go"), 0755)
+
+	job := generateJob{Generic: filepath.Join(dir, "gen", "slice.go"), Spec: filepath.Join(dir, "app", "main.go"), Directive: generateDirective}
+	if errors := newGenerator(".", nil).Run(job); len(errors) == 0 {
+		t.Error("Expected an error writing over a directory")
+	}
+	if fileExists(filepath.Join(dir, "app", manifestName)) {
+		t.Error("Expected output that failed to be written not to be recorded")
+	}
+}
@@ -39,6 +39,16 @@ func implementType(cp ContextPair, known ImplMap, gen, spec *ast.TypeSpec) (bool
 }
 
 func implementExpr(cp ContextPair, known ImplMap, gen, spec ast.Expr) (ok bool, err error) {
+	//Instantiated spec types such as List[int] are matched structurally by their instantiated declaration
+	//Identifiers still bind to the instantiation as a whole
+	switch gen.(type) {
+	case *ast.Ident, *ast.ParenExpr, *ast.IndexExpr, *ast.IndexListExpr:
+	default:
+		if inst, ok := cp.Provider.Instantiate(spec); ok {
+			spec = inst
+		}
+	}
+
 	// *Ident, *ParenExpr, *SelectorExpr, *StarExpr, or any of the *XxxTypes
 	switch genType := gen.(type) {
 	case *ast.Ident:
@@ -59,6 +69,27 @@ func implementExpr(cp ContextPair, known ImplMap, gen, spec ast.Expr) (ok bool,
 			return implementExpr(cp, known, genType.X, specType.X)
 		}
 
+	case *ast.IndexExpr:
+		if specType, ok := spec.(*ast.IndexExpr); ok {
+			if ok, err := implementExpr(cp, known, genType.X, specType.X); !ok {
+				return false, err
+			}
+			return implementExpr(cp, known, genType.Index, specType.Index)
+		}
+
+	case *ast.IndexListExpr:
+		if specType, ok := spec.(*ast.IndexListExpr); ok && len(genType.Indices) == len(specType.Indices) {
+			if ok, err := implementExpr(cp, known, genType.X, specType.X); !ok {
+				return false, err
+			}
+			for i, index := range genType.Indices {
+				if ok, err := implementExpr(cp, known, index, specType.Indices[i]); !ok {
+					return false, err
+				}
+			}
+			return true, nil
+		}
+
 	case *ast.StarExpr:
 		if specType, ok := spec.(*ast.StarExpr); ok {
 			return implementExpr(cp, known, genType.X, specType.X)
@@ -66,6 +97,9 @@ func implementExpr(cp ContextPair, known ImplMap, gen, spec ast.Expr) (ok bool,
 
 	case *ast.ArrayType:
 		if specType, ok := spec.(*ast.ArrayType); ok {
+			if ok, err := implementArrayLen(cp, known, genType.Len, specType.Len); !ok {
+				return false, err
+			}
 			return implementExpr(cp, known, genType.Elt, specType.Elt)
 		}
 
@@ -120,13 +154,25 @@ func implementExpr(cp ContextPair, known ImplMap, gen, spec ast.Expr) (ok bool,
 
 func implementIdent(cp ContextPair, known ImplMap, gen *ast.Ident, spec ast.Expr) (ok bool, err error) {
 
+	if isAnyIdent(gen) {
+		return known.Store(emptyInterface, spec)
+	}
+
 	if genType, isType := cp.Generic.LookupType(gen.Name); isType {
+		//Generic types that are already solved only need to agree with their existing mapping
+		//This is also what stops recursive types from being solved forever
+		if _, solved := known[gen.Name]; solved {
+			return known.Store(gen.Name, spec)
+		}
+
 		if ok = isEmptyInterface(genType.Type); ok {
 			known.Store(gen.Name, spec)
 			return
 		} else if ok, err = implementExpr(cp, known, genType.Type, spec); ok {
 			known.Store(gen.Name, spec)
 			return
+		} else if ok, err = implementNamedSpec(cp, known, gen, genType, spec); ok {
+			return
 		}
 		err = fmt.Errorf("Cannot implement %s with %s. Error: %s", gen.Name, ExprString(spec), err)
 		return
@@ -146,6 +192,63 @@ func implementIdent(cp ContextPair, known ImplMap, gen *ast.Ident, spec ast.Expr
 	return
 }
 
+//Array lengths are matched as value parameters. A constant declared in the generic file
+//can be implemented by any length, e.g. const N = 1; type Vec [N]T is implemented by [3]float64
+//Any other length must be the same in both, and slices only implement slices
+func implementArrayLen(cp ContextPair, known ImplMap, gen, spec ast.Expr) (ok bool, err error) {
+	if gen == nil || spec == nil {
+		if ok = (gen == nil && spec == nil); !ok {
+			err = fmt.Errorf("Cannot implement array length %s with %s, arrays and slices do not match", arrayLenString(gen), arrayLenString(spec))
+		}
+		return
+	}
+
+	if id, isIdent := gen.(*ast.Ident); isIdent {
+		if _, isConst := cp.Generic.LookupConst(id.Name); isConst {
+			return known.Store(id.Name, spec)
+		}
+	}
+
+	if ok = EquivalentExprs(gen, spec); !ok {
+		err = fmt.Errorf("Cannot implement array length %s with %s", ExprString(gen), ExprString(spec))
+	}
+	return
+}
+
+func arrayLenString(x ast.Expr) string {
+	if x == nil {
+		return "[]"
+	}
+	return "[" + ExprString(x) + "]"
+}
+
+//Spec types are usually referred to by name rather than declared inline (e.g. an embedded field, or []User)
+//so a generic type can also be implemented by the declaration that a spec identifier names
+func implementNamedSpec(cp ContextPair, known ImplMap, gen *ast.Ident, genType *ast.TypeSpec, spec ast.Expr) (ok bool, err error) {
+	specIdent, isIdent := spec.(*ast.Ident)
+	if !isIdent {
+		err = fmt.Errorf("Cannot implement %s with %s", gen.Name, ExprString(spec))
+		return
+	}
+
+	specType, isType := cp.Provider.LookupType(specIdent.Name)
+	if !isType {
+		err = fmt.Errorf("Cannot implement %s with %s", gen.Name, specIdent.Name)
+		return
+	}
+
+	//Map the generic type before descending so self-referencing types resolve to themselves
+	//Bindings are only kept once the whole declaration matches, so a partial match doesn't constrain the next candidate
+	trial := known.Copy()
+	trial[gen.Name] = spec
+	if ok, err = implementExpr(cp, trial, genType.Type, specType.Type); ok {
+		for name, x := range trial {
+			known[name] = x
+		}
+	}
+	return
+}
+
 func implementInterfaceType(cp ContextPair, known ImplMap, gen *ast.InterfaceType, spec ast.Expr) (ok bool, err error) {
 
 	if ok = isEmptyInterface(gen); !ok {
@@ -153,33 +256,33 @@ func implementInterfaceType(cp ContextPair, known ImplMap, gen *ast.InterfaceTyp
 		return
 	}
 
-	//ok, err = known.Store(emptyInterface, spec)
+	//Anonymous empty interfaces are an implicit type parameter
+	ok, err = known.Store(emptyInterface, spec)
 	return
 }
 
 func implementStruct(cp ContextPair, known ImplMap, gen, spec *ast.StructType) (ok bool, err error) {
 
-	genCount := gen.Fields.NumFields()
 	//Empty generic structs match any other stuct
-	if genCount == 0 {
+	if gen.Fields.NumFields() == 0 {
 		ok = true
 		return
 	}
 
-	specCount := spec.Fields.NumFields()
-	//Specification structs must have at least as many fields as generic stucts to be able to match
-	if specCount < genCount {
-		err = fmt.Errorf("Not enough fields to implement struct")
-		return
-	}
-
 	//Check that the specification struct implements all fields in the generic struct
-	//TODO How are embedded types handled?
+	//Fields promoted from embedded structs in the spec satisfy generic fields just like declared fields
 	//TODO Is there a way to support _ named fields? What would this mean?
 	for _, field := range gen.Fields.List {
+		if len(field.Names) == 0 {
+			if ok, err = implementEmbeddedField(cp, known, field, spec); !ok {
+				return
+			}
+			continue
+		}
+
 		for _, name := range field.Names {
-			var nameMatch *ast.Field
-			nameMatch, ok = FieldByName(spec.Fields, name.Name)
+			var nameMatch StructField
+			nameMatch, ok = cp.Provider.LookupField(spec, name.Name)
 			if !ok {
 				err = fmt.Errorf("Missing field %s", name.Name)
 				return
@@ -193,6 +296,57 @@ func implementStruct(cp ContextPair, known ImplMap, gen, spec *ast.StructType) (
 	return
 }
 
+//An embedded generic type is satisfied by any type embedded in the spec that implements it
+//Selectors of the embedded field get renamed along with the type when the generic is rewritten
+//Any other embedded type must also be embedded in the spec, either directly or through promotion
+func implementEmbeddedField(cp ContextPair, known ImplMap, field *ast.Field, spec *ast.StructType) (ok bool, err error) {
+
+	if !isGenericEmbedding(cp.Generic, field.Type) {
+		name, _ := embeddedFieldName(field.Type)
+		match, found := cp.Provider.LookupField(spec, name)
+		if !found || !match.IsEmbedded() {
+			err = fmt.Errorf("Missing embedded field %s", ExprString(field.Type))
+			return
+		}
+		return implementExpr(cp, known, field.Type, match.Type)
+	}
+
+	//Candidates are ordered shallowest first, so directly embedded types are preferred over promoted ones
+	for _, candidate := range cp.Provider.FieldsOf(spec) {
+		if !candidate.IsEmbedded() || isPointer(field.Type) != isPointer(candidate.Type) {
+			continue
+		}
+
+		trial := known.Copy()
+		if ok, _ = implementExpr(cp, trial, field.Type, candidate.Type); ok {
+			for k, v := range trial {
+				known[k] = v
+			}
+			return
+		}
+	}
+
+	err = fmt.Errorf("No embedded field can implement generic embedded type %s", ExprString(field.Type))
+	return
+}
+
+func isGenericEmbedding(gen *Context, x ast.Expr) bool {
+	if star, ok := x.(*ast.StarExpr); ok {
+		x = star.X
+	}
+
+	if id, ok := x.(*ast.Ident); ok {
+		_, isType := gen.LookupType(id.Name)
+		return isType
+	}
+	return false
+}
+
+func isPointer(x ast.Expr) bool {
+	_, ok := x.(*ast.StarExpr)
+	return ok
+}
+
 func implementFieldList(cp ContextPair, known ImplMap, gen, spec *ast.FieldList) (ok bool, err error) {
 	if gen == nil && spec == nil {
 		ok = true
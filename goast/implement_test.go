@@ -17,6 +17,20 @@ func Test_ImplMap(t *testing.T) {
 
 }
 
+func Test_ImplementNamedSpecPartialMatch(t *testing.T) {
+	generic, _ := NewSourceStringContext("package gen\ntype K interface{}\ntype Pair struct{ Key K; Value int }", "gen.go")
+	provider, _ := NewSourceStringContext("package main\ntype Entry struct{ Key string; Value string }", "spec.go")
+	pair, _ := generic.LookupType("Pair")
+
+	known := NewImplMap()
+	if ok, _ := implementNamedSpec(ContextPair{generic, provider}, known, pair.Name, pair, ast.NewIdent("Entry")); ok {
+		t.Fatal("Expected Entry not to implement Pair, as its Value isn't an int")
+	}
+	if len(known) != 0 {
+		t.Errorf("Expected a failed match to leave no bindings, found\n%s", known)
+	}
+}
+
 type ImplementTest struct {
 	Solves    bool
 	Gen, Spec string
@@ -45,6 +59,61 @@ func Test_Implement(t *testing.T) {
 		{true, `type M map[K]V
 				type K interface{}
 				type V interface{}`, "type IntMap map[string]ast.Expr"},
+		{true, `type T struct{
+					quit chan bool}`, `type Worker struct{ Base }
+										type Base struct{ quit chan bool }`},
+		{true, `type T struct{
+					Base
+					quit chan bool}
+				type Base struct{ id int }`, `type Service struct{
+										    *Registry
+										    Logger
+										    quit chan bool
+										}
+										type Registry struct{ id string }
+										type Logger struct{ id int }`},
+		{true, `type T struct{ sync.Mutex }`, `type Counter struct{
+										    Locker
+										    n int
+										}
+										type Locker struct{ sync.Mutex }`},
+		{true, `type N struct{ next *N }`, "type Node struct{ next *Node }"},
+		{true, `type V [N]T
+				const N = 1
+				type T interface{}`, "type Vec3 [3]float64"},
+		{true, `type M [N][N]T
+				const N = 1
+				type T interface{}`, "type Mat3 [3][3]float64"},
+		{false, `type M [N][N]T
+				const N = 1
+				type T interface{}`, "type Rect [3][4]float64"},
+		{false, `type V [4]T
+				type T interface{}`, "type Floats []float64"},
+		{false, `type V [4]T
+				type T interface{}`, "type Block [16]int"},
+		{false, `type S []T
+				type T interface{}`, "type Vec3 [3]float64"},
+		{true, "type T any", "type Email string"},
+		{true, "type S []any", "type Ints []int"},
+		{true, "type S []interface{}", "type Exprs []ast.Expr"},
+		{true, "type M map[interface{}][]interface{}", "type Index map[string][]string"},
+		{false, "type M map[interface{}]interface{}", "type IntMap map[string]int"},
+		{true, `type S []T
+				type T interface{}`, `type Ints List[int]
+										type List[E any] []E`},
+		{true, `type M map[K]V
+				type K interface{}
+				type V interface{}`, `type Ages Dict[string, int]
+										type Dict[K comparable, V any] map[K]V`},
+		{true, `type P struct{ p atomic.Pointer[T] }
+				type T interface{}`, "type Config struct{ p atomic.Pointer[Settings] }"},
+		{false, `type T struct{ id int }`, `type Both struct{ A; B }
+										type A struct{ id int }
+										type B struct{ id int }`},
+		{false, `type T struct{
+					*Base}
+				type Base struct{ id int }`, `type Service struct{ Logger }
+										type Logger struct{ id int }`},
 	}
 
 	for _, tst := range tests {
@@ -29,10 +29,28 @@ import (
 
 type Implementor struct {
 	TypeProvider *Context
+	//Types that generic types must be implemented by, e.g. T -> int. Only implementations that agree are generated
+	Bindings ImplMap
+	//Names of the spec types to implement the generic file for. Every spec type is a candidate when empty
+	//Other spec types can still implement the rest of the generic file
+	Targets []string
+	//The package to generate into, when it isn't the spec package
+	Output *outputPackage
+	//The receivers of methods generated on spec types, see receiverPolicy
+	Receivers string
+	//Whether spec aliases that can't have methods are implemented by wrapper types, see aliasWrapper
+	WrapAliases bool
+	//Directory of the spec package, which the packages of aliased types are found relative to
+	Dir string
+
+	//Reported once the implementation is written, see applyReceivers
+	warnings []string
+	//Wrappers of the spec aliases, by name
+	wrappers map[string]aliasWrapper
 }
 
 func NewImplementor(typeProvider *Context) *Implementor {
-	imp := &Implementor{typeProvider}
+	imp := &Implementor{TypeProvider: typeProvider, Bindings: NewImplMap()}
 	return imp
 }
 
@@ -54,161 +72,275 @@ func (a typesByComplexity) Less(i, j int) bool {
 	return a.Context.Complexity(a.typeSet[i]) > a.Context.Complexity(a.typeSet[j])
 }
 
+//A spec type that implements the primary generic type, along with every combination of
+//spec types that satisfies the rest of the generic file when it is the primary type
+type Solution struct {
+	Spec  *ast.TypeSpec
+	Impls implSet
+}
+
+func isRelatedType(t *ast.TypeSpec) bool {
+	return strings.Contains(t.Name.Name, "_")
+}
+
+func isImplType(t *ast.TypeSpec) bool {
+	return !isRelatedType(t)
+}
+
+//Types with their own type parameters can only be used once instantiated, e.g. type Ints List[int]
+func isInstantiable(t *ast.TypeSpec) bool {
+	return t.TypeParams == nil
+}
+
+//The generic types of a file that spec types must implement, ordered from most to least complex
+func implTypesOf(gen *Context) typeSet {
+	var genTypes typeSet = gen.Types()
+	implTypes := genTypes.Where(isImplType)
+	sort.Sort(typesByComplexity{implTypes, gen})
+	return implTypes
+}
+
 func (imp *Implementor) Transform(gen *Context) (result SourceSet, ok bool, errors []error) {
 
-	isRelatedType := func(t *ast.TypeSpec) bool { return strings.Contains(t.Name.Name, "_") }
-	isImplType := func(t *ast.TypeSpec) bool { return !isRelatedType(t) }
+	//Generics written with Go type parameters are monomorphized by lowering them to meta-code first
+	var constraints map[string]ast.Expr
+	if hasTypeParams(gen) {
+		if gen, constraints, errors = LowerTypeParams(gen); len(errors) != 0 {
+			return
+		}
+	}
+
+	solutions, errors := imp.Solve(gen)
+
+	implemented := implSet{}
+	for _, solution := range solutions {
+		solution, err := imp.satisfying(solution, constraints)
+		if len(solution.Impls) == 0 {
+			errors = append(errors, err)
+			continue
+		}
+
+		if solution, err = imp.bound(solution); len(solution.Impls) == 0 {
+			errors = append(errors, err)
+			continue
+		}
+
+		source, errs := imp.rewrite(gen, solution)
+		errors = append(errors, errs...)
+		if source != nil {
+			result = append(result, source)
+			implemented = append(implemented, solution.Impls...)
+		}
+	}
+
+	wrappers, errs := imp.wrapperSources(implemented)
+	errors = append(errors, errs...)
+	if len(result) != 0 {
+		result = append(result, wrappers...)
+	}
+
+	//If there are any results, an implementation was found and errors can be cleared
+	if len(result) != 0 {
+		errors = []error{}
+		ok = true
+	}
+
+	return
+}
+
+//Find every spec type that implements the generic file, and the type mappings that implement it
+//Candidates are solved concurrently, see solver
+func (imp *Implementor) Solve(gen *Context) (solutions []Solution, errors []error) {
 
 	var (
-		candidateTypes typeSet = imp.TypeProvider.Types()
-		genTypes       typeSet = gen.Types()
-		implTypes              = genTypes.Where(isImplType)
-		relatedTypes           = genTypes.Where(isRelatedType)
+		candidateTypes, unwrapped, aliasErrors = imp.specCandidates()
+		implTypes                              = implTypesOf(gen)
 	)
 
 	sort.Sort(typesByComplexity{candidateTypes, imp.TypeProvider})
-	sort.Sort(typesByComplexity{implTypes, gen})
 
 	if implTypes.Len() == 0 {
 		errors = append(errors, fmt.Errorf("Invalid generic specification: No Types!"))
 		return
 	}
 
-	primaryGeneric := implTypes[0]
-
 	implContext := ContextPair{gen, imp.TypeProvider}
+	imp.unwrappedAliases(implContext, unwrapped, implTypes[0])
 
-	//Test each type in the provider file for implementation
-	for _, c := range candidateTypes {
+	domains, domainErrors := domainsOf(implContext, implTypes, candidateTypes)
 
-		ok, primaryMap, err := Implement(implContext, NewImplMap(), c, primaryGeneric)
+	//Candidates that can't implement the primary generic type have nothing more to do
+	//Save their errors in case there is no implementation possible
+	errors = append(errors, domainErrors[0]...)
+	errors = append(errors, aliasErrors...)
 
-		//If this candidate can't implement the primary generic type, there is no more to do
-		//Save the error in case there is no implementation possible
-		if !ok {
-			errors = append(errors, err)
-			continue
+	solutions, errs := solveCandidates(implContext, implTypes, imp.targetedDomains(domains), domainErrors, nil)
+	errors = append(errors, errs...)
+
+	//Without a spec type that implements the primary composite type, it is derived from a spec type
+	//that implements one of the types it is composed of instead
+	if len(solutions) == 0 {
+		composite := compositeTypes(implTypes)
+		if types, ordered, orderedErrs, ok := derivingOrder(implTypes, domains, domainErrors, composite); ok {
+			solutions, errs = solveCandidates(implContext, types, imp.targetedDomains(ordered), orderedErrs, composite)
+			errors = append(errors, errs...)
 		}
+	}
 
-		//Types can only be matched once, so no need to keep the selected candidate
-		specTypes := candidateTypes.Where(func(t *ast.TypeSpec) bool {
-			return t.Name.Name != c.Name.Name
-		})
+	//If there are any solutions errors can be cleared
+	if len(solutions) != 0 {
+		errors = []error{}
+	}
 
-		matched := 0
+	return
+}
 
-		impls := implSet{primaryMap}
+//Only the primary generic type is limited to the targets, other spec types can still implement the rest
+func (imp *Implementor) targetedDomains(domains [][]assignment) [][]assignment {
+	if len(imp.Targets) == 0 {
+		return domains
+	}
+	targeted := append([][]assignment{}, domains...)
+	targeted[0] = imp.targeted(targeted[0])
+	return targeted
+}
 
-		for _, g := range implTypes {
-			subimpls := implSet{}
+func (imp *Implementor) targeted(candidates []assignment) (result []assignment) {
+	for _, c := range candidates {
+		if imp.isTarget(imp.specName(c.Spec.Name.Name)) {
+			result = append(result, c)
+		}
+	}
+	return
+}
 
-			foundMatch := false
+//Keep the implementations of a solution that agree with the required bindings
+func (imp *Implementor) bound(solution Solution) (result Solution, err error) {
+	result.Spec = solution.Spec
+	for _, imap := range solution.Impls {
+		agrees := true
+		for name, x := range imp.Bindings {
+			if bound, exists := imap[name]; !exists || !EquivalentExprs(bound, x) {
+				agrees = false
+				err = fmt.Errorf("%s is not implemented by %s for %s", name, ExprString(x), solution.Spec.Name.Name)
+				break
+			}
+		}
+		if agrees {
+			result.Impls = append(result.Impls, imap)
+		}
+	}
+	return
+}
 
-			for _, currentMap := range impls {
-				//types that already have mappings are already solved for
-				if _, ok := currentMap[g.Name.Name]; ok {
-					subimpls = append(subimpls, currentMap)
-					if !foundMatch {
-						foundMatch = true
-						matched += 1
-					}
-					continue
-				}
+//Rewrite the generic AST with the types provided by a solution
+func (imp *Implementor) rewrite(gen *Context, solution Solution) (source *SourceCode, errors []error) {
+	var genTypes typeSet = gen.Types()
+	relatedTypes := genTypes.Where(isRelatedType)
 
-				//check each specification type to see if it satisfies the requirements for this generic type
-				for _, s := range specTypes {
-					ok, resultMap, err := Implement(implContext, currentMap, s, g)
-					if ok {
-						subimpls = append(subimpls, resultMap)
-						if !foundMatch {
-							foundMatch = true
-							matched += 1
-						}
-						continue
-					} else {
-						errors = append(errors, err)
-					}
-				}
+	impPkg := &ast.Package{
+		Name:  imp.TypeProvider.File.Name.Name,
+		Files: make(map[string]*ast.File),
+	}
 
-			}
+	relatedImpl := map[string]bool{}
 
-			//being unable to satify a generic type indicates we can't implement with the current combination of types
-			//Save an error in case there is no implementation possible
-			if len(subimpls) == 0 {
-				errors = append(errors, fmt.Errorf("Unable to satisfy generic type %s with any of the specification types.", g.Name.Name))
-				break
-			}
+	name := imp.specName(solution.Spec.Name.Name)
 
-			//iterate on the new set of impls during the next iteration
-			impls = subimpls
+	for n, currentMap := range solution.Impls {
+		implAst, err := gen.Clone()
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
 
+		//Generic constants that were bound as array lengths are value parameters
+		isValueParam := func(name string) bool {
+			_, isConst := gen.LookupConst(name)
+			_, isBound := currentMap[name]
+			return isConst && isBound
 		}
 
-		//If all generic types are mapped, rewrite the generic AST with the provided types
-		if matched == implTypes.Len() {
-			impPkg := &ast.Package{
-				Name:  imp.TypeProvider.File.Name.Name,
-				Files: make(map[string]*ast.File),
+		//Filter impl types & previously implemented related types out of the current ast
+		//Do this prior to renaming related types so we can still identify them
+		//ast.FilterFile filters out import statements...always, so use custom filter method https://github.com/golang/go/issues/9248
+		filterTypeSpecs(implAst.File, func(t *ast.TypeSpec) bool {
+			//Derived impl types are declared like related types, see compositeTypes
+			if x := currentMap[t.Name.Name]; isDerived(x) {
+				_, exist := relatedImpl[ExprString(x)]
+				relatedImpl[ExprString(x)] = true
+				return !exist
+			}
+			if isRelatedType(t) {
+				specName := imp.relatedTypeName(t, currentMap)
+				_, exist := relatedImpl[specName]
+				relatedImpl[specName] = true
+				return !exist
 			}
+			return !isImplType(t)
+		})
 
-			relatedImpl := map[string]bool{}
+		//Value parameters are replaced by the spec's lengths, so their declarations go the same way as impl types
+		filterValueSpecs(implAst.File, func(v *ast.ValueSpec) bool {
+			for _, name := range v.Names {
+				if !isValueParam(name.Name) {
+					return true
+				}
+			}
+			return false
+		})
 
-			name := c.Name.Name
+		for _, warning := range imp.applyReceivers(implAst.File, currentMap) {
+			if !containsString(imp.warnings, warning) {
+				imp.warnings = append(imp.warnings, warning)
+			}
+		}
 
-			for n, currentMap := range impls {
-				implAst, err := gen.Clone()
-				if err != nil {
-					errors = append(errors, err)
-					continue
-				}
+		//Generate names for all related types
+		relatedTypes.Each(func(t *ast.TypeSpec) {
+			specName := imp.relatedTypeName(t, currentMap)
+			id := ast.NewIdent(specName)
+			currentMap.Store(t.Name.Name, id)
+		})
 
-				//Filter impl types & previously implemented related types out of the current ast
-				//Do this prior to renaming related types so we can still identify them
-				//ast.FilterFile filters out import statements...always, so use custom filter method https://github.com/golang/go/issues/9248
-				filterTypeSpecs(implAst.File, func(t *ast.TypeSpec) bool {
-					if isRelatedType(t) {
-						specName := imp.relatedTypeName(t, currentMap)
-						_, exist := relatedImpl[specName]
-						relatedImpl[specName] = true
-						return !exist
-					}
-					return !isImplType(t)
-				})
-
-				//Generate names for all related types
-				relatedTypes.Each(func(t *ast.TypeSpec) {
-					specName := imp.relatedTypeName(t, currentMap)
-					id := ast.NewIdent(specName)
-					currentMap.Store(t.Name.Name, id)
-				})
-
-				ast.Walk(ImplRewriter{currentMap}, implAst.File)
-
-				imports := ImportsOfImplMap(imp.TypeProvider, currentMap)
-				for _, i := range imports {
-					implAst.AddImportFromSpec(i)
-				}
+		ImplRewriter{ImplMap: currentMap}.RewriteValues(implAst.File, isValueParam)
 
-				//ensure that implementation is in the correct package
-				implAst.SetPackage(imp.TypeProvider.File.Name.Name)
-				fileName := fmt.Sprintf("%s_%d.go", name, n)
-				impPkg.Files[fileName] = implAst.File
+		//Every use of a value parameter has been substituted, so what's left of their names are locals that shadow them
+		typeMap, invalid := ImplMap{}, []error{}
+		for name, x := range currentMap {
+			if !isValueParam(name) {
+				typeMap[name] = x
 			}
+		}
+		ast.Walk(ImplRewriter{typeMap, &invalid}, implAst.File)
+		if len(invalid) != 0 {
+			errors = append(errors, invalid...)
+			continue
+		}
 
-			mergedAst := ast.MergePackageFiles(impPkg, ast.FilterFuncDuplicates|ast.FilterImportDuplicates)
-			mergedContext, _ := gen.Clone()
-			mergedContext.File = mergedAst
-
-			result = append(result, &SourceCode{mergedContext, name})
+		imports := ImportsOfImplMap(imp.TypeProvider, currentMap)
+		for _, i := range imports {
+			implAst.AddImportFromSpec(i)
 		}
+
+		//ensure that implementation is in the correct package
+		implAst.SetPackage(imp.TypeProvider.File.Name.Name)
+		fileName := fmt.Sprintf("%s_%d.go", name, n)
+		impPkg.Files[fileName] = implAst.File
 	}
 
-	//If there are any results, an implementation was found and errors can be cleared
-	if len(result) != 0 {
-		errors = []error{}
-		ok = true
+	mergedAst := ast.MergePackageFiles(impPkg, ast.FilterFuncDuplicates|ast.FilterImportDuplicates)
+	mergedContext, _ := gen.Clone()
+	mergedContext.File = mergedAst
+
+	if imp.Output != nil {
+		if errs := imp.relocate(mergedContext); len(errs) != 0 {
+			errors = append(errors, errs...)
+			return
+		}
 	}
 
+	source = &SourceCode{mergedContext, name}
 	return
 }
 
@@ -280,16 +412,28 @@ func NiceName(e ast.Expr) string {
 	case *ast.MapType:
 		return NiceName(t.Value) + "MapBy" + strings.Title(NiceName(t.Key))
 
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		base, indices := indexExprParts(t)
+		name := ""
+		for _, index := range indices {
+			name += NiceName(index)
+		}
+		return name + NiceName(base)
+
+	case *ast.InterfaceType:
+		return "Interface"
+
 	default:
 		return strings.Title(ExprString(e))
 	}
 }
 
 //Find and return a field with a given name within a field list
+//Embedded fields are found by the name of their type. Promoted fields need a Context, see Context.LookupField
 func FieldByName(list *ast.FieldList, name string) (field *ast.Field, found bool) {
 	for _, field = range list.List {
-		for _, ident := range field.Names {
-			if found = (ident.Name == name); found {
+		for _, fieldName := range fieldNames(field) {
+			if found = (fieldName == name); found {
 				return
 			}
 		}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+type TransformTest struct {
+	Gen, Spec string
+	Expect    []string
+}
+
+func Test_Transform(t *testing.T) {
+	tests := []TransformTest{
+		{`type Vec [N]T
+		  type T interface{}
+		  const N = 1
+		  func (v Vec) Sum() (sum T) {
+		  	for i := 0; i < N; i++ {
+		  		sum += v[i]
+		  	}
+		  	return
+		  }
+		  func (v Vec) Slice() []T {
+		  	var out [N]T = v
+		  	return out[:]
+		  }
+		  func (v Vec) At(N int) T {
+		  	return v[N]
+		  }
+		  func (v Vec) Last() T {
+		  	N := len(v) - 1
+		  	return v[N]
+		  }`,
+			"type Vec3 [3]float64",
+			[]string{"func (v Vec3) Sum() (sum float64)", "i < 3", "var out [3]float64 = v",
+				//Local declarations shadow the value parameter
+				"func (v Vec3) At(N int) float64 {\n\treturn v[N]", "N := len(v) - 1\n\treturn v[N]"}},
+		{`type Slice []interface{}
+		  func (s Slice) Where(fn func(any) bool) (result Slice) {
+		  	for _, v := range s {
+		  		if fn(v) {
+		  			result = append(result, v)
+		  		}
+		  	}
+		  	return
+		  }`,
+			"type Emails []string",
+			[]string{"func (s Emails) Where(fn func(string) bool) (result Emails)"}},
+		{`type Slice []T
+		  type T any
+		  func (s Slice) First() T {
+		  	return s[0]
+		  }`,
+			`type Ints List[int]
+			 type List[E any] []E`,
+			[]string{"func (s Ints) First() int"}},
+		{`type Slice[T any] []T
+		  func (s Slice[T]) Where(fn func(T) bool) (result Slice[T]) {
+		  	for _, v := range s {
+		  		if fn(v) {
+		  			result = append(result, v)
+		  		}
+		  	}
+		  	return
+		  }`,
+			"type Ints []int",
+			[]string{"func (s Ints) Where(fn func(int) bool) (result Ints)"}},
+		{`type Number interface{ ~int | ~float64 }
+		  type Vec[N Number] []N
+		  type sorter[N Number] struct {
+		  	Vec[N]
+		  }
+		  func (s sorter[N]) Less(i, j int) bool {
+		  	return s.Vec[i] < s.Vec[j]
+		  }
+		  func (v Vec[N]) Sort() {
+		  	sort.Sort(sorter[N]{v})
+		  }`,
+			"type Celsius []float64",
+			[]string{"type sorterCelsius struct", "func (s sorterCelsius) Less(i, j int) bool", "sort.Sort(sorterCelsius{v})", "func (v Celsius) Sort()"}},
+	}
+
+	for _, tst := range tests {
+		var (
+			src string
+			err error
+		)
+		if printed := capturedStdout(func() { src, err = transformSource(tst.Gen, tst.Spec) }); printed != "" {
+			t.Errorf("Expected nothing to be printed implementing %s, found %q", tst.Spec, printed)
+		}
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		for _, expect := range tst.Expect {
+			if !strings.Contains(src, expect) {
+				t.Errorf("Expected %q in implementation:\n%s", expect, src)
+			}
+		}
+		if strings.Contains(src, "const N") {
+			t.Errorf("Value parameter declaration was not removed:\n%s", src)
+		}
+	}
+}
+
+func Test_TransformConstraints(t *testing.T) {
+	gen := `type Number interface{ ~int | ~float64 }
+			type Vec[N Number] []N`
+
+	if _, err := transformSource(gen, "type Names []string"); err == nil {
+		t.Error("Expected []string not to satisfy Number")
+	}
+
+	if _, err := transformSource(gen, `type Temps []Celsius
+									   type Celsius float64`); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := transformSource("type Set[K comparable] map[K]bool", "type Groups map[string]bool"); err != nil {
+		t.Error(err)
+	}
+}
+
+//Implement a generic source against a spec source and print every resulting file
+func transformSource(gen, spec string) (src string, err error) {
+	generic, err := NewSourceStringContext("package gen\n"+gen, "gen.go")
+	if err != nil {
+		return
+	}
+
+	provider, err := NewSourceStringContext("package main\n"+spec, "spec.go")
+	if err != nil {
+		return
+	}
+
+	codes, ok, errors := NewImplementor(provider).Transform(generic)
+	if !ok {
+		err = fmt.Errorf("Transform failed: %v", errors)
+		return
+	}
+
+	var b bytes.Buffer
+	for _, code := range codes {
+		printer.Fprint(&b, token.NewFileSet(), code.File)
+	}
+	src = b.String()
+	return
+}
+
+//Everything a function prints to stdout
+func capturedStdout(fn func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		panic(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	fn()
+	os.Stdout = stdout
+	w.Close()
+
+	b, _ := ioutil.ReadAll(r)
+	r.Close()
+	return string(b)
+}
@@ -3,10 +3,14 @@ package main
 import (
 	"fmt"
 	"go/ast"
+
+	"golang.org/x/tools/go/ast/astutil"
 )
 
 type ImplRewriter struct {
 	ImplMap
+	//Identifiers bound to something other than an identifier, which can't be renamed in place
+	Invalid *[]error
 }
 
 func (imr ImplRewriter) Visit(node ast.Node) ast.Visitor {
@@ -33,6 +37,9 @@ func (imr ImplRewriter) Visit(node ast.Node) ast.Visitor {
 	case *ast.ParenExpr:
 		return imr.visitParenExpr(t)
 
+	case *ast.SelectorExpr:
+		return imr.visitSelectorExpr(t)
+
 	case *ast.StarExpr:
 		return imr.visitStarExpr(t)
 
@@ -80,8 +87,8 @@ func (imr ImplRewriter) visitIdent(node *ast.Ident) ast.Visitor {
 	if t, ok := imr.replacementType(node); ok {
 		if id, ok := t.(*ast.Ident); ok {
 			node.Name = id.Name
-		} else {
-			fmt.Printf("Invalid ident replacement for %s: %s", node.Name, ExprString(t))
+		} else if imr.Invalid != nil {
+			*imr.Invalid = append(*imr.Invalid, fmt.Errorf("Cannot replace %s with %s where it's used", node.Name, ExprString(t)))
 		}
 		return nil
 	}
@@ -115,6 +122,18 @@ func (imr ImplRewriter) visitParenExpr(node *ast.ParenExpr) ast.Visitor {
 	return imr
 }
 
+//Selecting an embedded generic type selects the field implicitly named after the type that replaces it
+func (imr ImplRewriter) visitSelectorExpr(node *ast.SelectorExpr) ast.Visitor {
+	if t, ok := imr.replacementType(node.Sel); ok {
+		if name, ok := embeddedFieldName(t); ok {
+			node.Sel = ast.NewIdent(name)
+		}
+		ast.Walk(imr, node.X)
+		return nil
+	}
+	return imr
+}
+
 func (imr ImplRewriter) visitStarExpr(node *ast.StarExpr) ast.Visitor {
 	if t, ok := imr.replacementType(node.X); ok {
 		node.X = t
@@ -131,15 +150,66 @@ func (imr ImplRewriter) visitField(node *ast.Field) ast.Visitor {
 	return imr
 }
 
+//Value parameters can be implemented by any constant expression rather than just an identifier,
+//so they are substituted ahead of the type rewrite, which is only able to rename identifiers
+//Identifiers that resolve to a local declaration, such as a parameter or N := len(v), shadow the value and are kept
+func (imr ImplRewriter) RewriteValues(file *ast.File, isValue func(string) bool) {
+	astutil.Apply(file, func(c *astutil.Cursor) bool {
+		id, ok := c.Node().(*ast.Ident)
+		if !ok || !isValue(id.Name) {
+			return true
+		}
+		if id.Obj != nil && id.Obj != file.Scope.Lookup(id.Name) {
+			return true
+		}
+
+		//Identifiers in these positions are names being declared or selected, not uses of the value
+		switch c.Name() {
+		case "Sel", "Name", "Names", "Label":
+			return true
+		}
+
+		if val, ok := imr.ImplMap[id.Name]; ok {
+			c.Replace(valueExpr(val))
+		}
+		return true
+	}, nil)
+}
+
+//Copy a constant expression so it can be placed in the generic ast
+//Anything more complex than a literal or identifier is parenthesized to keep its precedence
+func valueExpr(x ast.Expr) ast.Expr {
+	switch t := x.(type) {
+	case *ast.BasicLit:
+		return &ast.BasicLit{Kind: t.Kind, Value: t.Value}
+
+	case *ast.Ident:
+		return ast.NewIdent(t.Name)
+
+	default:
+		return &ast.ParenExpr{X: x}
+	}
+}
+
 //Determines what if anything a given ast node should be replaced with
 func (imr ImplRewriter) replacementType(node ast.Node) (ast.Expr, bool) {
 	switch t := node.(type) {
 	case *ast.Ident:
+		if isAnyIdent(t) {
+			return imr.replacementType(&ast.InterfaceType{Methods: &ast.FieldList{}})
+		}
 		if val, ok := imr.ImplMap[t.Name]; ok {
 			return val, true
 		}
 		return nil, false
 
+	case *ast.InterfaceType:
+		if !isEmptyInterface(t) {
+			return nil, false
+		}
+		val, ok := imr.ImplMap[emptyInterface]
+		return val, ok
+
 	default:
 		return nil, false
 	}
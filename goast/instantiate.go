@@ -0,0 +1,99 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+//Instantiate a generic type declared with type parameters, e.g. List[int] for type List[T any] []T
+//results in []int. Only types declared in the context's package can be instantiated
+func (c *Context) Instantiate(x ast.Expr) (inst ast.Expr, ok bool) {
+	base, args := indexExprParts(x)
+	id, isIdent := base.(*ast.Ident)
+	if !isIdent {
+		return
+	}
+
+	spec, isType := c.LookupType(id.Name)
+	if !isType || spec.TypeParams == nil {
+		return
+	}
+
+	params := map[string]ast.Expr{}
+	for _, field := range spec.TypeParams.List {
+		for _, name := range field.Names {
+			if len(params) == len(args) {
+				return
+			}
+			params[name.Name] = args[len(params)]
+		}
+	}
+
+	if len(params) != len(args) {
+		return
+	}
+
+	return substituteIdents(spec.Type, params)
+}
+
+//Copy an expression, replacing identifiers with the expressions they are mapped to
+func substituteIdents(x ast.Expr, with map[string]ast.Expr) (result ast.Expr, ok bool) {
+	//Round trip through the printer so the declaration itself is left untouched
+	copied, err := parser.ParseExpr(ExprString(x))
+	if err != nil {
+		return
+	}
+
+	result = astutil.Apply(copied, func(c *astutil.Cursor) bool {
+		id, isIdent := c.Node().(*ast.Ident)
+		if !isIdent {
+			return true
+		}
+
+		switch c.Name() {
+		case "Sel", "Names":
+			return true
+		}
+
+		if val, found := with[id.Name]; found {
+			c.Replace(val)
+		}
+		return true
+	}, nil).(ast.Expr)
+
+	ok = true
+	return
+}
+
+//Split an instantiated type into the generic type and its type arguments
+func indexExprParts(x ast.Expr) (base ast.Expr, indices []ast.Expr) {
+	switch t := x.(type) {
+	case *ast.IndexExpr:
+		return t.X, []ast.Expr{t.Index}
+
+	case *ast.IndexListExpr:
+		return t.X, t.Indices
+
+	default:
+		return x, nil
+	}
+}
@@ -24,21 +24,111 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+	"unicode"
 )
 
 const VERSION = "0.4.1"
 
 func main() {
 	var (
-		app = kingpin.New("goast", "An AST utility for Go")
+		app  = kingpin.New("goast", "An AST utility for Go")
+		tags = app.Flag("tags", "Comma separated build tags that decide which files of spec and generic packages are parsed").Default("").String()
 
-		writeCmd = app.Command("write", "Generate code with various AST transformations")
+		writeCmd = &subcommands{CmdClause: app.Command("write", "Generate code with various AST transformations")}
 
 		writeImpl        = writeCmd.Command("impl", "Generate an implementation of a generically defined file")
 		writeImplGeneric = writeImpl.Arg("generic", "Generic file to implement").Required().String()
 		writeImplSpec    = writeImpl.Arg("spec", "Spec file that provides types to the generic file. Defaults to $GOFILE during go:generate.").Default(os.ExpandEnv("$GOFILE")).String()
 		writeImplPrefix  = writeImpl.Flag("prefix", "Prefix for generated files").Default("").String()
 		writeImplSuffix  = writeImpl.Flag("suffix", "Suffix for generated files").Default("").String()
+		writeImplOutDir  = writeImpl.Flag("out-dir", "Directory to generate into, if not the spec file's").Default("").String()
+		writeImplPackage = writeImpl.Flag("package", "Package to generate into. Defaults to the package in --out-dir, or its name").Default("").String()
+		writeImplForm    = writeImpl.Flag("form", "How methods on spec types are generated into another package: wrapper (the default) or func").Default("").String()
+		writeImplSingle  = writeImpl.Flag("single-file", "Merge every implementation into one file of this name, instead of a file per spec type").Default("").String()
+		writeImplScope   = writeImpl.Flag("spec-scope", "Draw spec types from the spec file, or every file in its package: file (the default) or package").Default("").String()
+		writeImplRecv    = writeImpl.Flag("receivers", "Receivers of the methods generated on spec types: pointer, value or match. Defaults to the generic's //goast:receivers directive").Default("").String()
+		writeImplWrap    = writeImpl.Flag("wrap-aliases", "Implement spec aliases of types that can't have methods, such as types of other packages, with wrapper types").Bool()
+		writeImplNoCache = writeImpl.Flag("no-cache", "Always implement the generic, without reading or writing the generation cache").Bool()
+		writeImplVerbose = writeImpl.Flag("verbose", "Report generation cache hits and misses").Short('v').Bool()
+
+		writeDelegate       = writeCmd.Command("delegate", "Generate methods that forward to a field, for every method of the field a struct doesn't declare itself")
+		writeDelegateSpec   = writeDelegate.Arg("spec", "Spec file of the structs to generate for. Defaults to $GOFILE during go:generate.").Default(os.ExpandEnv("$GOFILE")).String()
+		writeDelegateField  = writeDelegate.Flag("field", "Field to forward to. Defaults to every field of interface type").Default("").String()
+		writeDelegateTypes  = writeDelegate.Flag("type", "Struct to generate for, may be repeated. Defaults to every struct with a field to forward to").Strings()
+		writeDelegatePrefix = writeDelegate.Flag("prefix", "Prefix for generated files").Default("").String()
+		writeDelegateSuffix = writeDelegate.Flag("suffix", "Suffix for generated files").Default("").String()
+
+		writeMock       = writeCmd.Command("mock", "Generate a fake of each interface, that records its calls and calls a function set for each method")
+		writeMockSpec   = writeMock.Arg("spec", "Spec file of the interfaces to generate fakes of. Defaults to $GOFILE during go:generate.").Default(os.ExpandEnv("$GOFILE")).String()
+		writeMockTypes  = writeMock.Flag("type", "Interface to generate a fake of, may be repeated. Defaults to every interface in the spec file").Strings()
+		writeMockPrefix = writeMock.Flag("prefix", "Prefix for generated files").Default("").String()
+		writeMockSuffix = writeMock.Flag("suffix", "Suffix for generated files, e.g. _test to only build fakes with tests").Default("").String()
+
+		writeAccessors        = writeCmd.Command("accessors", "Generate getters and setters for the unexported fields of structs")
+		writeAccessorsSpec    = writeAccessors.Arg("spec", "Spec file of the structs to generate for. Defaults to $GOFILE during go:generate.").Default(os.ExpandEnv("$GOFILE")).String()
+		writeAccessorsTypes   = writeAccessors.Flag("type", "Struct to generate for, may be repeated. Defaults to every struct in the spec file").Strings()
+		writeAccessorsInclude = writeAccessors.Flag("include", "Field to generate for, may be repeated. Defaults to every field").Strings()
+		writeAccessorsExclude = writeAccessors.Flag("exclude", "Field to leave out, may be repeated").Strings()
+		writeAccessorsPrefix  = writeAccessors.Flag("prefix", "Prefix for generated files").Default("").String()
+		writeAccessorsSuffix  = writeAccessors.Flag("suffix", "Suffix for generated files").Default("").String()
+
+		writeBuilder        = writeCmd.Command("builder", "Generate a fluent builder for structs, with a method to set each field and a Build method")
+		writeBuilderSpec    = writeBuilder.Arg("spec", "Spec file of the structs to generate for. Defaults to $GOFILE during go:generate.").Default(os.ExpandEnv("$GOFILE")).String()
+		writeBuilderTypes   = writeBuilder.Flag("type", "Struct to generate for, may be repeated. Defaults to every struct in the spec file").Strings()
+		writeBuilderInclude = writeBuilder.Flag("include", "Field to generate for, may be repeated. Defaults to every field").Strings()
+		writeBuilderExclude = writeBuilder.Flag("exclude", "Field to leave out, may be repeated").Strings()
+		writeBuilderPrefix  = writeBuilder.Flag("prefix", "Prefix for generated files").Default("").String()
+		writeBuilderSuffix  = writeBuilder.Flag("suffix", "Suffix for generated files").Default("").String()
+
+		writeDeepCopy       = writeCmd.Command("deepcopy", "Generate Clone methods that deep copy types")
+		writeDeepCopySpec   = writeDeepCopy.Arg("spec", "Spec file of the types to generate for. Defaults to $GOFILE during go:generate.").Default(os.ExpandEnv("$GOFILE")).String()
+		writeDeepCopyTypes  = writeDeepCopy.Flag("type", "Type to generate for, may be repeated. Defaults to every type in the spec file").Strings()
+		writeDeepCopyCycles = writeDeepCopy.Flag("cycles", "Track the pointers visited, so values with cycles through pointers can be copied").Bool()
+		writeDeepCopyPrefix = writeDeepCopy.Flag("prefix", "Prefix for generated files").Default("").String()
+		writeDeepCopySuffix = writeDeepCopy.Flag("suffix", "Suffix for generated files").Default("").String()
+
+		writeEqual       = writeCmd.Command("equal", "Generate Equal methods that compare types deeply")
+		writeEqualSpec   = writeEqual.Arg("spec", "Spec file of the types to generate for. Defaults to $GOFILE during go:generate.").Default(os.ExpandEnv("$GOFILE")).String()
+		writeEqualTypes  = writeEqual.Flag("type", "Type to generate for, may be repeated. Defaults to every type in the spec file").Strings()
+		writeEqualCycles = writeEqual.Flag("cycles", "Track the pointers visited, so values with cycles through pointers can be compared").Bool()
+		writeEqualPrefix = writeEqual.Flag("prefix", "Prefix for generated files").Default("").String()
+		writeEqualSuffix = writeEqual.Flag("suffix", "Suffix for generated files").Default("").String()
+
+		writeEnum           = writeCmd.Command("enum", "Generate String, parsing and marshalling for integer types with constants")
+		writeEnumSpec       = writeEnum.Arg("spec", "Spec file of the enums to generate for. Defaults to $GOFILE during go:generate.").Default(os.ExpandEnv("$GOFILE")).String()
+		writeEnumTypes      = writeEnum.Flag("type", "Enum to generate for, may be repeated. Defaults to every integer type with constants in the spec file").Strings()
+		writeEnumTrimPrefix = writeEnum.Flag("trim-prefix", "Prefix to trim from constant names to give the names of their values").Default("").String()
+		writeEnumPrefix     = writeEnum.Flag("prefix", "Prefix for generated files").Default("").String()
+		writeEnumSuffix     = writeEnum.Flag("suffix", "Suffix for generated files").Default("").String()
+
+		migrateCmd = app.Command("migrate", "Migrate goast generic code to Go type parameters")
+
+		migrateGeneric       = migrateCmd.Command("generic", "Rewrite a generic file or package in place to use type parameters")
+		migrateGenericPath   = migrateGeneric.Arg("generic", "Generic file or package to migrate").Required().String()
+		migrateGenericDryRun = migrateGeneric.Flag("dry-run", "Print the migrated source instead of writing it").Bool()
+
+		migrateImpl        = migrateCmd.Command("impl", "Replace generated implementations of a generic package with instantiations of its migrated types")
+		migrateImplGeneric = migrateImpl.Arg("generic", "Generic package that was implemented").Required().String()
+		migrateImplSpec    = migrateImpl.Arg("spec", "Spec file that provided types to the generic package. Defaults to $GOFILE during go:generate.").Default(os.ExpandEnv("$GOFILE")).String()
+		migrateImplPrefix  = migrateImpl.Flag("prefix", "Prefix the generated files were written with").Default("").String()
+		migrateImplSuffix  = migrateImpl.Flag("suffix", "Suffix the generated files were written with").Default("").String()
+		migrateImplDryRun  = migrateImpl.Flag("dry-run", "Print the migrated spec file and the files that would be removed").Bool()
+
+		generateCmd        = app.Command("generate", "Generate every implementation listed in a project configuration file, or annotated with //goast:impl")
+		generateConfigPath = generateCmd.Arg("config", "Configuration file listing the jobs to run, or packages to find annotations in such as ./...").Default("goast.json").String()
+		generateNoCache    = generateCmd.Flag("no-cache", "Always implement generics, without reading or writing the generation cache").Bool()
+		generateVerbose    = generateCmd.Flag("verbose", "Report generation cache hits and misses").Short('v').Bool()
+
+		watchCmd      = app.Command("watch", "Regenerate implementations whenever their generics or spec types change")
+		watchTarget   = watchCmd.Arg("config", "Configuration file listing the jobs to watch, or packages to find annotations in").Default("./...").String()
+		watchInterval = watchCmd.Flag("interval", "How often to check for changes").Default("1s").String()
+		watchNoCache  = watchCmd.Flag("no-cache", "Always implement generics, without reading or writing the generation cache").Bool()
+		watchVerbose  = watchCmd.Flag("verbose", "Report generation cache hits and misses").Short('v').Bool()
+
+		cleanCmd    = app.Command("clean", "Remove generated files that are no longer produced by any directive")
+		cleanTarget = cleanCmd.Arg("config", "Packages whose go:generate directives and annotations are current, such as ./..., or a configuration file").Default("./...").String()
+		cleanDryRun = cleanCmd.Flag("dry-run", "Print the files that would be removed").Bool()
 
 		printCmd       = app.Command("print", "Print various representations of an ast to stdout")
 		printDecls     = printCmd.Command("decls", "Print a summary of the top level declarations of a file")
@@ -47,9 +137,72 @@ func main() {
 
 	app.Version(version())
 
-	switch kingpin.MustParse(app.Parse(os.Args[1:])) {
+	//Plugins take whatever arguments they like, so they're found before the arguments are parsed
+	if name, args, isPlugin := pluginCommand(os.Args[1:], writeCmd.names); isPlugin {
+		runPlugin(name, args)
+		return
+	}
+
+	command := kingpin.MustParse(app.Parse(os.Args[1:]))
+	build.Default.BuildTags = buildTags(*tags)
+
+	switch command {
 	case writeImpl.FullCommand():
-		implement(*writeImplGeneric, *writeImplSpec, writeConfig{*writeImplPrefix, *writeImplSuffix})
+		var cache *generationCache
+		if !*writeImplNoCache {
+			cache = openGenerationCache(*writeImplVerbose)
+		}
+		cfg := writeConfig{Prefix: *writeImplPrefix, Suffix: *writeImplSuffix, Package: *writeImplPackage, Form: *writeImplForm, SingleFile: *writeImplSingle, SpecScope: *writeImplScope, Receivers: *writeImplRecv, WrapAliases: *writeImplWrap}
+		implement(*writeImplGeneric, *writeImplSpec, *writeImplOutDir, cfg, cache)
+
+	case writeDelegate.FullCommand():
+		delegate(*writeDelegateSpec, *writeDelegateField, *writeDelegateTypes, writeConfig{Prefix: *writeDelegatePrefix, Suffix: *writeDelegateSuffix})
+
+	case writeMock.FullCommand():
+		mock(*writeMockSpec, *writeMockTypes, writeConfig{Prefix: *writeMockPrefix, Suffix: *writeMockSuffix})
+
+	case writeAccessors.FullCommand():
+		accessors(*writeAccessorsSpec, *writeAccessorsTypes, *writeAccessorsInclude, *writeAccessorsExclude, writeConfig{Prefix: *writeAccessorsPrefix, Suffix: *writeAccessorsSuffix})
+
+	case writeBuilder.FullCommand():
+		builders(*writeBuilderSpec, *writeBuilderTypes, *writeBuilderInclude, *writeBuilderExclude, writeConfig{Prefix: *writeBuilderPrefix, Suffix: *writeBuilderSuffix})
+
+	case writeDeepCopy.FullCommand():
+		deepcopy(*writeDeepCopySpec, *writeDeepCopyTypes, *writeDeepCopyCycles, writeConfig{Prefix: *writeDeepCopyPrefix, Suffix: *writeDeepCopySuffix})
+
+	case writeEqual.FullCommand():
+		equal(*writeEqualSpec, *writeEqualTypes, *writeEqualCycles, writeConfig{Prefix: *writeEqualPrefix, Suffix: *writeEqualSuffix})
+
+	case writeEnum.FullCommand():
+		enum(*writeEnumSpec, *writeEnumTypes, *writeEnumTrimPrefix, writeConfig{Prefix: *writeEnumPrefix, Suffix: *writeEnumSuffix})
+
+	case generateCmd.FullCommand():
+		var cache *generationCache
+		if !*generateNoCache {
+			cache = openGenerationCache(*generateVerbose)
+		}
+		generate(*generateConfigPath, cache)
+
+	case watchCmd.FullCommand():
+		interval, err := time.ParseDuration(*watchInterval)
+		if err != nil {
+			fmt.Println("Invalid interval: ", err)
+			return
+		}
+		var cache *generationCache
+		if !*watchNoCache {
+			cache = openGenerationCache(*watchVerbose)
+		}
+		watch(*watchTarget, interval, cache)
+
+	case cleanCmd.FullCommand():
+		clean(*cleanTarget, *cleanDryRun)
+
+	case migrateGeneric.FullCommand():
+		migrateGenericSource(*migrateGenericPath, *migrateGenericDryRun)
+
+	case migrateImpl.FullCommand():
+		migrateImplementations(*migrateImplGeneric, *migrateImplSpec, writeConfig{Prefix: *migrateImplPrefix, Suffix: *migrateImplSuffix}, *migrateImplDryRun)
 
 	case printDecls.FullCommand():
 		printFileDecls(*printDeclsFile)
@@ -60,30 +213,37 @@ func main() {
 
 }
 
-func implement(genericPath, specFile string, cfg writeConfig) {
-
-	specFile = strings.TrimSpace(specFile)
-	typeProvider, err := NewFilePackageContext(specFile)
-	if err != nil {
-		fmt.Println("Error in type provider file: ", err)
-		return
-	}
-
-	genericPath = strings.TrimSpace(genericPath)
+//A command that remembers the names of the subcommands registered on it, which kingpin doesn't list
+type subcommands struct {
+	*kingpin.CmdClause
+	names []string
+}
 
-	imp := NewImplementor(typeProvider)
+func (c *subcommands) Command(name, help string) *kingpin.CmdClause {
+	c.names = append(c.names, name)
+	return c.CmdClause.Command(name, help)
+}
 
-	files, err := targetGenericSource(genericPath)
-	if err != nil {
-		fmt.Printf("Failed to generate %s\n%s", genericPath, err.Error())
-		return
-	}
+//Implement a generic file or package on a spec file. Implementations are cached unless cache is nil
+func implement(genericPath, specFile, outDir string, cfg writeConfig, cache *generationCache) {
+	job := generateJob{
+		Generic:     strings.TrimSpace(genericPath),
+		Spec:        strings.TrimSpace(specFile),
+		Prefix:      cfg.Prefix,
+		Suffix:      cfg.Suffix,
+		Out:         outDir,
+		Package:     cfg.Package,
+		Form:        cfg.Form,
+		SingleFile:  cfg.SingleFile,
+		SpecScope:   cfg.SpecScope,
+		Receivers:   cfg.Receivers,
+		WrapAliases: cfg.WrapAliases,
 
-	fmt.Printf("Implement %s on %s\n", genericPath, specFile)
-	for _, genericFile := range files {
-		RewriteFile(genericFile, filepath.Dir(specFile), imp, cfg)
+		Directive: generateDirective,
 	}
 
+	fmt.Printf("Implement %s on %s\n", job.Generic, job.Spec)
+	printErrors(newGenerator(".", cache).Run(job))
 }
 
 func targetGenericSource(path string) ([]string, error) {
@@ -95,16 +255,11 @@ func targetGenericSource(path string) ([]string, error) {
 		}
 	}
 
-	workingDir, err := os.Getwd()
+	pkg, err := importGenericPackage(path)
 	if err != nil {
 		return nil, err
 	}
 
-	pkg, err := build.Default.Import(path, workingDir, 0)
-	if err != nil {
-		return nil, fmt.Errorf("Cannot find path %s locally or in GOPATH. Error: %s", path, err.Error())
-	}
-
 	files := []string{}
 	for _, file := range pkg.GoFiles {
 		files = append(files, filepath.Join(pkg.Dir, file))
@@ -113,6 +268,19 @@ func targetGenericSource(path string) ([]string, error) {
 	return files, nil
 }
 
+func importGenericPackage(path string) (*build.Package, error) {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	pkg, err := build.Default.Import(path, workingDir, 0)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot find path %s locally or in GOPATH. Error: %s", path, err.Error())
+	}
+	return pkg, nil
+}
+
 func printFileDecls(path string) {
 	println("Printing ", path)
 	c, err := NewFileContext(path)
@@ -123,6 +291,13 @@ func printFileDecls(path string) {
 	PrintDecls(c.File)
 }
 
+//Build tags may be separated by commas or spaces, like go build -tags
+func buildTags(tags string) []string {
+	return strings.FieldsFunc(tags, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
 func version() string {
 	return VERSION
 }
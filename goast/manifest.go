@@ -0,0 +1,223 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//The file in each output directory that records which files goast generated there
+const manifestName = "goast.manifest"
+
+const generateDirective = "go:generate"
+
+//The files goast generated in a directory, by the job that generated them
+//Generated file names only follow a naming convention, so without a manifest there is no telling
+//which files goast owns once the spec types they were generated for are renamed or removed
+type manifest struct {
+	Entries []manifestEntry `json:"entries"`
+	dir     string
+}
+
+//Jobs are recorded relative to the manifest's directory, so the same directive is recognised
+//whether it is run from the package or from the root of a project
+type manifestEntry struct {
+	Directive string      `json:"directive"`
+	Job       generateJob `json:"job"`
+	Files     []string    `json:"files"`
+}
+
+//Annotated types that share options are implemented by one job, so annotations are identified without their types
+//That way the outputs of an annotation that was removed are stale, rather than their whole job orphaned
+func (e manifestEntry) ID() string {
+	job := e.Job
+	if e.Directive == annotationDirective {
+		job.Types = nil
+	}
+	return e.Directive + " " + job.String()
+}
+
+//Reports whether goast generated a file in a directory, according to its manifest
+func generatedIn(dir string) func(name string) bool {
+	generated := map[string]bool{}
+	if m, err := loadManifest(dir); err == nil {
+		for _, entry := range m.Entries {
+			for _, file := range entry.Files {
+				generated[file] = true
+			}
+		}
+	}
+	return func(name string) bool {
+		return generated[name]
+	}
+}
+
+func loadManifest(dir string) (m *manifest, err error) {
+	m = &manifest{dir: dir}
+	b, err := ioutil.ReadFile(filepath.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(b, m); err != nil {
+		err = fmt.Errorf("Invalid manifest in %s: %s", dir, err)
+	}
+	return
+}
+
+//Write the manifest, or remove it once there is nothing left to record
+func (m *manifest) Save() error {
+	path := filepath.Join(m.dir, manifestName)
+	if len(m.Entries) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+func (m *manifest) Lookup(id string) (entry manifestEntry, index int, ok bool) {
+	for index, entry = range m.Entries {
+		if ok = (entry.ID() == id); ok {
+			return
+		}
+	}
+	return manifestEntry{}, -1, false
+}
+
+//Record the files an entry produced, returning the files it produced last time but no longer does
+//Files other entries still produce, such as alias wrappers, aren't stale
+func (m *manifest) Update(entry manifestEntry) (stale []string) {
+	previous, i, found := m.Lookup(entry.ID())
+	if !found {
+		m.Entries = append(m.Entries, entry)
+		return
+	}
+
+	m.Entries[i] = entry
+	for _, file := range missingStrings(previous.Files, entry.Files) {
+		if !m.produces(file) {
+			stale = append(stale, file)
+		}
+	}
+	return
+}
+
+func (m *manifest) produces(file string) bool {
+	for _, entry := range m.Entries {
+		if containsString(entry.Files, file) {
+			return true
+		}
+	}
+	return false
+}
+
+//Remove generated files from the manifest's directory
+func (m *manifest) Remove(files []string) (errors []error) {
+	for _, file := range files {
+		if err := os.Remove(filepath.Join(m.dir, file)); err != nil && !os.IsNotExist(err) {
+			errors = append(errors, err)
+			continue
+		}
+		fmt.Printf("Removed %s\n", filepath.Join(m.dir, file))
+	}
+	return
+}
+
+//The strings in a that aren't in b
+func missingStrings(a, b []string) (missing []string) {
+	for _, s := range a {
+		if !containsString(b, s) {
+			missing = append(missing, s)
+		}
+	}
+	return
+}
+
+//Rewrite the paths of a job to be relative to the directory it generates into
+func (g *generator) manifestEntry(job generateJob, outputDirectory string) manifestEntry {
+	rel := func(p string) string {
+		return relativeTo(outputDirectory, p)
+	}
+
+	entry := manifestEntry{Directive: job.Directive, Job: job}
+	entry.Job.Spec = rel(g.path(job.Spec))
+	entry.Job.Out = ""
+	entry.Job.Directive = ""
+	if strings.HasSuffix(job.Generic, ".go") {
+		entry.Job.Generic = rel(g.path(job.Generic))
+	}
+	//Configuration files are given relative to the working directory rather than the generator's root
+	if strings.HasSuffix(job.Directive, ".json") {
+		entry.Directive = rel(job.Directive)
+	}
+	return entry
+}
+
+//A path relative to a directory, or the path itself when it can't be made relative
+func relativeTo(dir, p string) string {
+	if r, err := filepath.Rel(absPath(dir), absPath(p)); err == nil {
+		return filepath.ToSlash(r)
+	}
+	return p
+}
+
+func absPath(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	return abs
+}
+
+//Record the files a job wrote in its output directory's manifest, removing any it no longer produces
+func (g *generator) record(job generateJob, outputDirectory string, written []string) (errors []error) {
+	return recordOutputs(outputDirectory, g.manifestEntry(job, outputDirectory), written)
+}
+
+//Record the files an entry wrote in a directory's manifest, removing any it no longer produces
+func recordOutputs(dir string, entry manifestEntry, written []string) (errors []error) {
+	m, err := loadManifest(dir)
+	if err != nil {
+		return []error{err}
+	}
+
+	entry.Files = written
+	if _, _, found := m.Lookup(entry.ID()); !found && len(written) == 0 {
+		return
+	}
+
+	errors = m.Remove(m.Update(entry))
+	if err := m.Save(); err != nil {
+		errors = append(errors, err)
+	}
+	return
+}
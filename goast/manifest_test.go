@@ -0,0 +1,166 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTestFiles(dir string, files map[string]string) {
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte(src), 0644)
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+const manifestGeneric = `package gen
+type T interface{}
+type Slice []T
+func (s Slice) First() T { return s[0] }`
+
+func Test_ManifestRemovesStaleOutputs(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	writeTestFiles(dir, map[string]string{
+		"gen/slice.go": manifestGeneric,
+		"app/main.go":  "package main\ntype Ints []int\ntype Names []string",
+		"goast.json":   `{"jobs": [{"generic": "gen/slice.go", "spec": "app/main.go"}]}`,
+	})
+	config := filepath.Join(dir, "goast.json")
+
+	generate(config, nil)
+	m, _ := loadManifest(filepath.Join(dir, "app"))
+	if len(m.Entries) != 1 || !reflect.DeepEqual(m.Entries[0].Files, []string{"ints_slice.go", "names_slice.go"}) {
+		t.Fatalf("Expected the manifest to record both outputs, found %+v", m.Entries)
+	}
+
+	writeTestFiles(dir, map[string]string{"app/main.go": "package main\ntype Ints []int\ntype Strings []string"})
+	generate(config, nil)
+
+	if fileExists(filepath.Join(dir, "app", "names_slice.go")) {
+		t.Error("Expected the output of a renamed spec type to be removed")
+	}
+	if !fileExists(filepath.Join(dir, "app", "strings_slice.go")) || !fileExists(filepath.Join(dir, "app", "ints_slice.go")) {
+		t.Error("Expected current outputs to be written")
+	}
+}
+
+func Test_Clean(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	genFile := filepath.Join(dir, "gen", "slice.go")
+	writeTestFiles(dir, map[string]string{
+		"gen/slice.go": manifestGeneric,
+		"app/main.go":  "package main\n//goast:impl " + genFile + "\ntype Ints []int\n//goast:impl " + genFile + "\ntype Names []string",
+	})
+	pattern := filepath.Join(dir, "app") + "/..."
+
+	generate(pattern, nil)
+	if !fileExists(filepath.Join(dir, "app", "names_slice.go")) {
+		t.Fatal("Expected annotated types to be implemented")
+	}
+
+	//Removing an annotation makes its output stale
+	writeTestFiles(dir, map[string]string{"app/main.go": "package main\n//goast:impl " + genFile + "\ntype Ints []int\ntype Names []string"})
+
+	clean(pattern, true)
+	if !fileExists(filepath.Join(dir, "app", "names_slice.go")) {
+		t.Fatal("Expected a dry run not to remove anything")
+	}
+
+	clean(pattern, false)
+	if fileExists(filepath.Join(dir, "app", "names_slice.go")) || !fileExists(filepath.Join(dir, "app", "ints_slice.go")) {
+		t.Error("Expected only the output of the removed annotation to be removed")
+	}
+
+	writeTestFiles(dir, map[string]string{"app/main.go": "package main\ntype Ints []int"})
+	clean(pattern, false)
+	if fileExists(filepath.Join(dir, "app", "ints_slice.go")) || fileExists(filepath.Join(dir, "app", manifestName)) {
+		t.Error("Expected every output and the manifest to be removed once nothing is annotated")
+	}
+}
+
+func Test_TransformManifest(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	const directive = "package app\n//go:generate goast write deepcopy\n"
+	specFile := filepath.Join(dir, "app", "app.go")
+	writeTestFiles(dir, map[string]string{"app/app.go": directive + "type Tags []string\ntype Names []string"})
+
+	deepcopy(specFile, nil, false, writeConfig{})
+	m, _ := loadManifest(filepath.Join(dir, "app"))
+	if len(m.Entries) != 1 || !reflect.DeepEqual(m.Entries[0].Files, []string{"tags_deepcopy.go", "names_deepcopy.go"}) {
+		t.Fatalf("Expected the manifest to record the outputs of deepcopy, found %+v", m.Entries)
+	}
+
+	//Generated files aren't spec types of the package
+	if !generatedIn(filepath.Join(dir, "app"))("tags_deepcopy.go") {
+		t.Error("Expected deepcopy output to be known as generated")
+	}
+
+	writeTestFiles(dir, map[string]string{"app/app.go": directive + "type Tags []string\ntype Labels []string"})
+	deepcopy(specFile, nil, false, writeConfig{})
+	if fileExists(filepath.Join(dir, "app", "names_deepcopy.go")) || !fileExists(filepath.Join(dir, "app", "labels_deepcopy.go")) {
+		t.Error("Expected the output of a renamed type to be replaced")
+	}
+
+	pattern := filepath.Join(dir, "app") + "/..."
+	writeTestFiles(dir, map[string]string{"app/app.go": directive + "type Tags []string"})
+	clean(pattern, false)
+	if fileExists(filepath.Join(dir, "app", "labels_deepcopy.go")) || !fileExists(filepath.Join(dir, "app", "tags_deepcopy.go")) {
+		t.Error("Expected clean to remove only the output of the removed type")
+	}
+
+	writeTestFiles(dir, map[string]string{"app/app.go": "package app\ntype Tags []string"})
+	clean(pattern, false)
+	if fileExists(filepath.Join(dir, "app", "tags_deepcopy.go")) || fileExists(filepath.Join(dir, "app", manifestName)) {
+		t.Error("Expected clean to remove every output once the directive is gone")
+	}
+}
+
+func Test_ParseWriteImplArgs(t *testing.T) {
+	tests := []struct {
+		Args   []string
+		Expect generateJob
+	}{
+		{[]string{"goast.net/x/iter"}, generateJob{Generic: "goast.net/x/iter", Spec: "app/main.go"}},
+		{[]string{"--prefix=gen_", "goast.net/x/iter", "$GOFILE"}, generateJob{Generic: "goast.net/x/iter", Spec: "app/main.go", Prefix: "gen_"}},
+		{[]string{"--suffix", "_gen", "../gen/slice.go", "types.go"}, generateJob{Generic: "gen/slice.go", Spec: "app/types.go", Suffix: "_gen"}},
+		{[]string{"--single-file", "slices.go", "goast.net/x/iter"}, generateJob{Generic: "goast.net/x/iter", Spec: "app/main.go", SingleFile: "slices.go"}},
+		{[]string{"--tags", "linux", "goast.net/x/iter"}, generateJob{Generic: "goast.net/x/iter", Spec: "app/main.go"}},
+	}
+
+	for _, tst := range tests {
+		tst.Expect.Directive = generateDirective
+		job, err := parseWriteImplArgs(tst.Args, "app/main.go")
+		if err != nil || !reflect.DeepEqual(job, tst.Expect) {
+			t.Errorf("Expected %+v for %v, found %+v %v", tst.Expect, tst.Args, job, err)
+		}
+	}
+}
+
+func Test_GenerateDirectiveJobsGlobalFlags(t *testing.T) {
+	src := "package main\n//go:generate goast --tags foo write impl --prefix=gen_ goast.net/x/iter\n//go:generate goast --verbose write impl goast.net/x/sort\n"
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, errors := generateDirectiveJobs(file, "app/main.go")
+	if len(errors) != 0 || len(jobs) != 2 || jobs[0].Generic != "goast.net/x/iter" || jobs[0].Prefix != "gen_" || jobs[1].Generic != "goast.net/x/sort" {
+		t.Errorf("Expected the jobs of both directives after their global flags, found %+v %v", jobs, errors)
+	}
+}
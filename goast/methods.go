@@ -0,0 +1,292 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+//Finds the methods of types, whether they're declared in the spec package or a package it imports
+type methodResolver struct {
+	//Spec package, so types can be declared anywhere in it, see NewPackageContext
+	Package *Context
+	//Directory of the spec package, which imported packages are found relative to
+	Dir string
+
+	imported map[string]*Context
+}
+
+func newMethodResolver(pkg *Context, dir string) methodResolver {
+	return methodResolver{pkg, dir, map[string]*Context{}}
+}
+
+//A method of a type, along with the package its signature was declared in
+type declaredMethod struct {
+	Name string
+	Type *ast.FuncType
+	//Whether the method has a pointer receiver, so can only be called on an addressable field
+	Pointer bool
+	Decl    *Context
+	//Import of the declaring package that its types are qualified by, nil when it's the spec package
+	From *ast.ImportSpec
+}
+
+//The methods of a type, declared in ctx. Types of other packages are parsed from their source, found with go/build
+func (r *methodResolver) methodsOf(ctx *Context, from *ast.ImportSpec, x ast.Expr, seen map[string]bool) (methods []declaredMethod, err error) {
+	switch t := x.(type) {
+	case *ast.StarExpr:
+		return r.methodsOf(ctx, from, t.X, seen)
+
+	case *ast.SelectorExpr:
+		pkg, i, err := r.importedPackage(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		return r.methodsOf(pkg, i, t.Sel, seen)
+
+	case *ast.InterfaceType:
+		for _, field := range t.Methods.List {
+			if len(field.Names) == 0 {
+				//Type terms such as ~int | ~float64 only constrain type parameters, they have no methods
+				switch field.Type.(type) {
+				case *ast.UnaryExpr, *ast.BinaryExpr:
+					continue
+				}
+				embedded, err := r.methodsOf(ctx, from, field.Type, seen)
+				if err != nil {
+					return nil, err
+				}
+				methods = append(methods, embedded...)
+				continue
+			}
+			if ft, isFunc := field.Type.(*ast.FuncType); isFunc {
+				methods = append(methods, declaredMethod{field.Names[0].Name, ft, false, ctx, from})
+			}
+		}
+
+	case *ast.Ident:
+		key := ctx.File.Name.Name + "." + t.Name
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+
+		spec, isType := ctx.LookupType(t.Name)
+		switch {
+		case !isType && t.Name == "error":
+			return []declaredMethod{{"Error", errorMethod(), false, ctx, nil}}, nil
+		case !isType && (t.Name == "comparable" || t.Name == "any"):
+			return
+		case !isType:
+			return nil, fmt.Errorf("%s is not a type declared in package %s", t.Name, ctx.File.Name.Name)
+		}
+		if _, isInterface := spec.Type.(*ast.InterfaceType); isInterface {
+			return r.methodsOf(ctx, from, spec.Type, seen)
+		}
+
+		for _, f := range ctx.Funcs() {
+			if recvName, ok := methodRecieverTypeIdentifier(f); ok && recvName == t.Name {
+				methods = append(methods, declaredMethod{f.Name.Name, f.Type, isPointer(f.Recv.List[0].Type), ctx, from})
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("%s has no methods to delegate", ExprString(x))
+	}
+
+	return
+}
+
+//The Error() string method of the predeclared error interface
+func errorMethod() *ast.FuncType {
+	return &ast.FuncType{
+		Params:  &ast.FieldList{},
+		Results: &ast.FieldList{List: []*ast.Field{{Type: ast.NewIdent("string")}}},
+	}
+}
+
+//The package a selector such as io.Reader refers to, and the import it's referred to by
+func (r *methodResolver) importedPackage(ctx *Context, sel *ast.SelectorExpr) (pkg *Context, i *ast.ImportSpec, err error) {
+	id, isIdent := sel.X.(*ast.Ident)
+	if !isIdent {
+		return nil, nil, fmt.Errorf("%s is not a type of an imported package", ExprString(sel))
+	}
+
+	i, found := ctx.LookupImport(id.Name)
+	if !found {
+		return nil, nil, fmt.Errorf("%s is not imported", id.Name)
+	}
+	importPath, _ := strconv.Unquote(i.Path.Value)
+
+	//Types are qualified by the selector's name, so the import must be by that name too
+	if i.Name == nil && path.Base(importPath) != id.Name {
+		i = &ast.ImportSpec{Name: ast.NewIdent(id.Name), Path: i.Path}
+	}
+
+	if pkg, found = r.imported[importPath]; found {
+		return
+	}
+
+	//Imports are found relative to the spec package, so module dependencies resolve the way they build
+	bp, err := build.Default.Import(importPath, r.Dir, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(bp.GoFiles) == 0 {
+		return nil, nil, fmt.Errorf("Package %s has no Go files", importPath)
+	}
+	if pkg, err = NewPackageContext(filepath.Join(bp.Dir, bp.GoFiles[0]), func(string) bool { return false }); err != nil {
+		return
+	}
+	r.imported[importPath] = pkg
+	return
+}
+
+//The signature of a method as it's written in the spec package
+func (m declaredMethod) signature() *ast.FuncType {
+	copied, _ := substituteIdents(m.Type, nil)
+	return qualifiedIn(copied, m.Decl, m.From).(*ast.FuncType)
+}
+
+//Qualify the types of a copied expression that are declared in another package by the import it's referred to by
+func qualifiedIn(x ast.Expr, decl *Context, from *ast.ImportSpec) ast.Expr {
+	if from == nil {
+		return x
+	}
+
+	qualifier := path.Base(strings.Trim(from.Path.Value, `"`))
+	if from.Name != nil {
+		qualifier = from.Name.Name
+	}
+
+	return astutil.Apply(x, func(c *astutil.Cursor) bool {
+		switch t := c.Node().(type) {
+		case *ast.SelectorExpr:
+			//Already qualified by another package
+			return false
+		case *ast.Ident:
+			if c.Name() == "Names" {
+				return true
+			}
+			if _, isType := decl.LookupType(t.Name); isType {
+				c.Replace(qualified(qualifier, t.Name))
+			}
+		}
+		return true
+	}, nil).(ast.Expr)
+}
+
+//The imports a method's signature needs in the spec package
+func (m declaredMethod) imports() (imports ImportSpecs) {
+	fields := m.Type.Params.List
+	if m.Type.Results != nil {
+		fields = append(append([]*ast.Field{}, fields...), m.Type.Results.List...)
+	}
+
+	for _, field := range fields {
+		imports = append(imports, m.Decl.SelectedImports(field.Type)...)
+		if m.From == nil {
+			continue
+		}
+
+		//Types of the declaring package are qualified by its import
+		ast.Inspect(field.Type, func(node ast.Node) bool {
+			switch t := node.(type) {
+			case *ast.SelectorExpr:
+				return false
+			case *ast.Ident:
+				if _, isType := m.Decl.LookupType(t.Name); isType {
+					imports = append(imports, m.From)
+				}
+			}
+			return true
+		})
+	}
+	return
+}
+
+//Name the parameters of a signature so they can be passed on, returning them as arguments
+//Unnamed and blank parameters, and those named the same as a reserved name like a receiver or as a package the
+//signature uses, are named by their position, skipping names the other parameters already have
+func nameParams(sig *ast.FuncType, reserved ...string) (args []string) {
+	taken := map[string]bool{}
+	for _, name := range reserved {
+		taken[name] = true
+	}
+	//A parameter named after a package would hide it from the types used in the body
+	packages := map[string]bool{}
+	ast.Inspect(sig, func(node ast.Node) bool {
+		if sel, ok := node.(*ast.SelectorExpr); ok {
+			if pkg, ok := sel.X.(*ast.Ident); ok {
+				packages[pkg.Name] = true
+				taken[pkg.Name] = true
+			}
+		}
+		return true
+	})
+	for _, field := range sig.Params.List {
+		for _, id := range field.Names {
+			taken[id.Name] = true
+		}
+	}
+
+	for _, field := range sig.Params.List {
+		if len(field.Names) == 0 {
+			field.Names = []*ast.Ident{ast.NewIdent("_")}
+		}
+		for k, id := range field.Names {
+			if id.Name == "_" || containsString(reserved, id.Name) || packages[id.Name] {
+				name := fmt.Sprintf("arg%d", len(args))
+				for n := 1; taken[name]; n++ {
+					name = fmt.Sprintf("arg%d_%d", len(args), n)
+				}
+				taken[name] = true
+				field.Names[k] = ast.NewIdent(name)
+			}
+			arg := field.Names[k].Name
+			if _, isVariadic := field.Type.(*ast.Ellipsis); isVariadic {
+				arg += "..."
+			}
+			args = append(args, arg)
+		}
+	}
+	return
+}
+
+//Give each result of a signature its own field without a name, since names could clash with a receiver's
+func unnameResults(sig *ast.FuncType) {
+	if sig.Results == nil {
+		return
+	}
+
+	results := []*ast.Field{}
+	for _, field := range sig.Results.List {
+		for k := 0; k < len(field.Names) || k == 0; k++ {
+			results = append(results, &ast.Field{Type: field.Type})
+		}
+	}
+	sig.Results.List = results
+}
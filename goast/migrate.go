@@ -0,0 +1,638 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+//The type parameters a goast generic file has when written with Go type parameters
+type typeParams struct {
+	//Empty interface types that act as type parameters, in declaration order
+	Params []string
+	//Parameters used as map keys, which need to be constrained to comparable
+	Comparable map[string]bool
+	//The parameters each generic type depends on, either directly or through other generic types
+	Uses map[string][]string
+}
+
+func analyzeTypeParams(gen *Context) (tp typeParams) {
+	tp.Comparable = map[string]bool{}
+	tp.Uses = map[string][]string{}
+
+	var genTypes typeSet = gen.Types()
+
+	isParam := map[string]bool{}
+	for _, t := range genTypes {
+		if isTypeParam(t) {
+			tp.Params = append(tp.Params, t.Name.Name)
+			isParam[t.Name.Name] = true
+		}
+	}
+
+	ast.Inspect(gen.File, func(node ast.Node) bool {
+		if m, ok := node.(*ast.MapType); ok {
+			if id, ok := m.Key.(*ast.Ident); ok && isParam[id.Name] {
+				tp.Comparable[id.Name] = true
+			}
+		}
+		return true
+	})
+
+	//Start from the parameters each type names directly
+	//then keep adding the parameters of the generic types it names until nothing changes
+	used := map[string]map[string]bool{}
+	refs := map[string][]string{}
+	for _, t := range genTypes {
+		if !isParam[t.Name.Name] {
+			used[t.Name.Name] = map[string]bool{}
+		}
+	}
+
+	for name := range used {
+		t, _ := genTypes.First(func(t *ast.TypeSpec) bool { return t.Name.Name == name })
+		ast.Inspect(t.Type, func(node ast.Node) bool {
+			if id, ok := node.(*ast.Ident); ok {
+				if isParam[id.Name] {
+					used[name][id.Name] = true
+				} else if _, isGeneric := used[id.Name]; isGeneric {
+					refs[name] = append(refs[name], id.Name)
+				}
+			}
+			return true
+		})
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for name, rs := range refs {
+			for _, r := range rs {
+				for p := range used[r] {
+					if !used[name][p] {
+						used[name][p] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+
+	for name, set := range used {
+		tp.Uses[name] = tp.ordered(set)
+	}
+	return
+}
+
+//Empty interface types declared in a generic file are its type parameters
+func isTypeParam(t *ast.TypeSpec) bool {
+	return isImplType(t) && isEmptyInterface(t.Type)
+}
+
+//The parameters a declaration depends on, in declaration order
+func (tp typeParams) usedBy(node ast.Node) []string {
+	set := map[string]bool{}
+	ast.Inspect(node, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			for _, p := range tp.Params {
+				if p == id.Name {
+					set[p] = true
+				}
+			}
+			for _, p := range tp.Uses[id.Name] {
+				set[p] = true
+			}
+		}
+		return true
+	})
+	return tp.ordered(set)
+}
+
+func (tp typeParams) ordered(set map[string]bool) (params []string) {
+	for _, p := range tp.Params {
+		if set[p] {
+			params = append(params, p)
+		}
+	}
+	return
+}
+
+//A type parameter list, e.g. [K comparable, V any]
+func (tp typeParams) fieldList(params []string) *ast.FieldList {
+	list := &ast.FieldList{}
+	for _, p := range params {
+		constraint := "any"
+		if tp.Comparable[p] {
+			constraint = "comparable"
+		}
+
+		//Consecutive parameters with the same constraint share a field, e.g. [T, U any]
+		if n := len(list.List); n > 0 && list.List[n-1].Type.(*ast.Ident).Name == constraint {
+			list.List[n-1].Names = append(list.List[n-1].Names, ast.NewIdent(p))
+			continue
+		}
+		list.List = append(list.List, &ast.Field{Names: []*ast.Ident{ast.NewIdent(p)}, Type: ast.NewIdent(constraint)})
+	}
+	return list
+}
+
+//An instantiation of a generic type with a list of type arguments, e.g. Map[K, V]
+//Brackets are positioned at the end of the generic type so the printer keeps the instantiation on one line
+func instantiation(x ast.Expr, args []ast.Expr) ast.Expr {
+	if len(args) == 1 {
+		return &ast.IndexExpr{X: x, Lbrack: x.End(), Index: args[0], Rbrack: x.End()}
+	}
+	return &ast.IndexListExpr{X: x, Lbrack: x.End(), Indices: args, Rbrack: x.End()}
+}
+
+//Reset every position within a node, so the printer lays it out without regard to where it came from
+func clearPositions(node ast.Node) {
+	posType := reflect.TypeOf(token.NoPos)
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		v := reflect.ValueOf(n).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.Type() == posType && f.CanSet() {
+				f.SetInt(int64(token.NoPos))
+			}
+		}
+		return true
+	})
+}
+
+//The type declaration a resolved identifier refers to, if any
+func typeSpecOf(id *ast.Ident) (spec *ast.TypeSpec, ok bool) {
+	if id.Obj != nil && id.Obj.Kind == ast.Typ {
+		spec, ok = id.Obj.Decl.(*ast.TypeSpec)
+	}
+	return
+}
+
+//Rewrite a goast generic file in place to use Go type parameters
+//type T interface{}; type Slice []T becomes type Slice[T any] []T, and every use of Slice becomes Slice[T]
+//Related types lose their placeholder, so _Sorter becomes Sorter[T]
+func MigrateGeneric(gen *Context) (errors []error) {
+	tp := analyzeTypeParams(gen)
+
+	if len(tp.Params) == 0 {
+		errors = append(errors, fmt.Errorf("No type parameters found. Type parameters are declared as empty interface types"))
+		return
+	}
+
+	var genTypes typeSet = gen.Types()
+
+	if genTypes.Any(func(t *ast.TypeSpec) bool { return t.TypeParams != nil }) {
+		errors = append(errors, fmt.Errorf("Generic file already uses type parameters"))
+		return
+	}
+
+	ast.Inspect(gen.File, func(node ast.Node) bool {
+		if a, ok := node.(*ast.ArrayType); ok && a.Len != nil {
+			if id, ok := a.Len.(*ast.Ident); ok {
+				if _, isConst := gen.LookupConst(id.Name); isConst {
+					errors = append(errors, fmt.Errorf("Array length %s is a value parameter, which can't be expressed with type parameters", id.Name))
+				}
+			}
+		}
+		return true
+	})
+
+	renames := map[string]string{}
+	for _, t := range genTypes.Where(isRelatedType) {
+		name := strings.Replace(t.Name.Name, "_", "", -1)
+		_, exists := gen.LookupType(name)
+		if name == "" || exists {
+			errors = append(errors, fmt.Errorf("Cannot name related type %s once its placeholder is removed", t.Name.Name))
+			continue
+		}
+		renames[t.Name.Name] = name
+	}
+
+	//Methods can't declare their own type parameters, so they can only use the parameters of their receiver
+	for _, f := range gen.Funcs() {
+		used := tp.usedBy(f)
+		rcvr, isMethod := methodRecieverTypeIdentifier(f)
+		if !isMethod {
+			if len(used) > 0 {
+				f.Type.TypeParams = tp.fieldList(used)
+			}
+			continue
+		}
+
+		for _, p := range used {
+			if !containsString(tp.Uses[rcvr], p) {
+				errors = append(errors, fmt.Errorf("Method %s.%s uses type parameter %s, which %s does not depend on", rcvr, f.Name.Name, p, rcvr))
+			}
+		}
+	}
+
+	if len(errors) != 0 {
+		return
+	}
+
+	//Work out every generic type's name and parameters up front, declarations are renamed as they're visited
+	names := map[*ast.TypeSpec]string{}
+	genTypes.Each(func(t *ast.TypeSpec) {
+		if _, isGeneric := tp.Uses[t.Name.Name]; isGeneric {
+			names[t] = t.Name.Name
+			if rename, ok := renames[t.Name.Name]; ok {
+				names[t] = rename
+			}
+		}
+	})
+
+	for t := range names {
+		if params := tp.Uses[t.Name.Name]; len(params) > 0 {
+			t.TypeParams = tp.fieldList(params)
+		}
+	}
+
+	astutil.Apply(gen.File, func(c *astutil.Cursor) bool {
+		id, ok := c.Node().(*ast.Ident)
+		if !ok {
+			return true
+		}
+
+		spec, isType := typeSpecOf(id)
+		if !isType {
+			return true
+		}
+
+		name, isGeneric := names[spec]
+		if !isGeneric {
+			return true
+		}
+
+		//The declaration itself only needs renaming, its type parameters are already declared
+		params := spec.TypeParams
+		if c.Name() == "Name" || params == nil {
+			id.Name = name
+			return true
+		}
+
+		var args []ast.Expr
+		for _, field := range params.List {
+			for _, param := range field.Names {
+				args = append(args, &ast.Ident{NamePos: id.End(), Name: param.Name})
+			}
+		}
+		c.Replace(instantiation(&ast.Ident{NamePos: id.Pos(), Name: name}, args))
+		return true
+	}, nil)
+
+	filterTypeSpecs(gen.File, func(t *ast.TypeSpec) bool {
+		return !isTypeParam(t)
+	})
+
+	if gen.CommentMap != nil {
+		gen.File.Comments = gen.CommentMap.Filter(gen.File).Comments()
+	}
+	return
+}
+
+//A spec type that can be replaced with an instantiation of a migrated generic type
+type Instantiation struct {
+	Spec *ast.TypeSpec
+	//The instantiation the spec type becomes an alias of, e.g. iter.Slice[int]
+	Alias ast.Expr
+}
+
+//Find the spec types that a generic file was implemented for, which can become aliases
+//of the migrated generic type instead, e.g. type Ints []int becomes type Ints = iter.Slice[int]
+//Uses the same inference as Implementor.Transform, so the generic may be migrated before or after its instantiations
+//Spec types only qualify when they have exactly the structure of the instantiated generic type
+func MigrateInstantiations(gen, spec *Context, qualifier string) (insts []Instantiation, errors []error) {
+	var (
+		imp         = NewImplementor(spec)
+		constraints map[string]ast.Expr
+		migrated    = gen
+	)
+
+	if hasTypeParams(gen) {
+		if gen, constraints, errors = LowerTypeParams(gen); len(errors) != 0 {
+			return
+		}
+	}
+
+	solutions, errors := imp.Solve(gen)
+	if len(solutions) == 0 {
+		return
+	}
+
+	primary := implTypesOf(gen)[0]
+	params := analyzeTypeParams(gen).Uses[primary.Name.Name]
+
+	//Already migrated generics may declare their parameters in any order
+	if t, ok := migrated.LookupType(primary.Name.Name); ok && t.TypeParams != nil {
+		params = nil
+		for _, field := range t.TypeParams.List {
+			for _, name := range field.Names {
+				params = append(params, name.Name)
+			}
+		}
+	}
+
+	if len(params) == 0 {
+		errors = append(errors, fmt.Errorf("Generic type %s has no type parameters to instantiate", primary.Name.Name))
+		return
+	}
+
+	for _, solution := range solutions {
+		solution, err := imp.satisfying(solution, constraints)
+		if len(solution.Impls) == 0 {
+			errors = append(errors, err)
+			continue
+		}
+
+		inst, err := instantiationOf(solution, primary, params, qualifier)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		insts = append(insts, inst)
+	}
+	return
+}
+
+func instantiationOf(solution Solution, primary *ast.TypeSpec, params []string, qualifier string) (inst Instantiation, err error) {
+	for _, imap := range solution.Impls {
+		args := []ast.Expr{}
+		for _, p := range params {
+			if arg, bound := imap[p]; bound {
+				if arg, ok := substituteIdents(arg, nil); ok {
+					args = append(args, arg)
+				}
+			}
+		}
+
+		if len(args) != len(params) {
+			continue
+		}
+
+		if structure, ok := substituteIdents(primary.Type, imap); !ok || !EquivalentExprs(structure, solution.Spec.Type) {
+			continue
+		}
+
+		//Arguments are copied from all over the spec file, so drop their positions to keep the alias on one line
+		for _, arg := range args {
+			clearPositions(arg)
+		}
+		base := &ast.SelectorExpr{X: ast.NewIdent(qualifier), Sel: ast.NewIdent(primary.Name.Name)}
+		inst = Instantiation{solution.Spec, instantiation(base, args)}
+		return
+	}
+
+	err = fmt.Errorf("%s does not have the same structure as any instantiation of %s", solution.Spec.Name.Name, primary.Name.Name)
+	return
+}
+
+//Replace the declaration of the instantiated spec type with an alias
+func (inst Instantiation) Apply(file *ast.File) (ok bool) {
+	for _, decl := range file.Decls {
+		g, isGenDecl := decl.(*ast.GenDecl)
+		if !isGenDecl {
+			continue
+		}
+		for _, s := range g.Specs {
+			if t, isType := s.(*ast.TypeSpec); isType && t.Name.Name == inst.Spec.Name.Name && !t.Assign.IsValid() {
+				t.Assign = t.Name.End()
+				t.Type = inst.Alias
+				ok = true
+			}
+		}
+	}
+	return
+}
+
+//Remove any go:generate directives that implement the given generic path
+func removeGenerateDirectives(file *ast.File, genericPath string) {
+	isDirective := func(c *ast.Comment) bool {
+		fields := strings.Fields(c.Text)
+		return len(fields) > 3 &&
+			fields[0] == "//go:generate" && fields[1] == "goast" && fields[2] == "write" && fields[3] == "impl" &&
+			containsString(fields[4:], genericPath)
+	}
+
+	groups := file.Comments[:0]
+	for _, group := range file.Comments {
+		list := group.List[:0]
+		for _, c := range group.List {
+			if !isDirective(c) {
+				list = append(list, c)
+			}
+		}
+		group.List = list
+		if len(list) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	file.Comments = groups
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func migrateGenericSource(genericPath string, dryRun bool) {
+	files, err := targetGenericSource(strings.TrimSpace(genericPath))
+	if err != nil {
+		fmt.Printf("Failed to migrate %s\n%s\n", genericPath, err.Error())
+		return
+	}
+
+	for _, file := range files {
+		gen, err := NewFileCommentContext(file)
+		if err != nil {
+			printErrors([]error{err})
+			continue
+		}
+
+		if errors := MigrateGeneric(gen); len(errors) != 0 {
+			fmt.Printf("Cannot migrate %s\n", file)
+			printErrors(errors)
+			continue
+		}
+
+		writeMigratedFile(gen, file, dryRun)
+	}
+}
+
+func migrateImplementations(genericPath, specFile string, cfg writeConfig, dryRun bool) {
+	genericPath = strings.TrimSpace(genericPath)
+	specFile = strings.TrimSpace(specFile)
+
+	if strings.HasSuffix(genericPath, ".go") {
+		fmt.Printf("Cannot migrate implementations of %s. Instantiations need an importable generic package\n", genericPath)
+		return
+	}
+
+	pkg, err := importGenericPackage(genericPath)
+	if err != nil {
+		fmt.Printf("Failed to migrate %s\n%s\n", genericPath, err.Error())
+		return
+	}
+
+	typeProvider, err := NewFilePackageContext(specFile)
+	if err != nil {
+		fmt.Println("Error in type provider file: ", err)
+		return
+	}
+
+	var (
+		specDir   = filepath.Dir(specFile)
+		aliases   = map[string]Instantiation{}
+		generated = map[string][]string{}
+		failed    = false
+	)
+
+	for _, file := range pkg.GoFiles {
+		genericFile := filepath.Join(pkg.Dir, file)
+		gen, err := NewFileContext(genericFile)
+		if err != nil {
+			printErrors([]error{err})
+			failed = true
+			continue
+		}
+
+		insts, errors := MigrateInstantiations(gen, typeProvider, pkg.Name)
+		printErrors(errors)
+		failed = failed || len(errors) != 0
+
+		for _, inst := range insts {
+			name := inst.Spec.Name.Name
+			if prev, exists := aliases[name]; exists && !EquivalentExprs(prev.Alias, inst.Alias) {
+				fmt.Printf("Error: %s instantiates both %s and %s\n", name, ExprString(prev.Alias), ExprString(inst.Alias))
+				failed = true
+				continue
+			}
+			aliases[name] = inst
+			generated[name] = append(generated[name], filepath.Join(specDir, generatedFileName(cfg, name, genericFile)))
+		}
+	}
+
+	//Aliases of types from another package can't have methods declared on them
+	for name := range aliases {
+		if file, declared := methodsDeclaredOutside(typeProvider, name, generated[name]); declared {
+			fmt.Printf("Error: %s has methods declared in %s and cannot become an alias\n", name, file)
+			delete(aliases, name)
+			failed = true
+		}
+	}
+
+	if len(aliases) == 0 {
+		fmt.Printf("No implementations of %s in %s could be migrated\n", genericPath, specFile)
+		return
+	}
+
+	spec, err := NewFileCommentContext(specFile)
+	if err != nil {
+		printErrors([]error{err})
+		return
+	}
+
+	for _, inst := range aliases {
+		inst.Apply(spec.File)
+	}
+
+	if pkg.Name == path.Base(pkg.ImportPath) {
+		astutil.AddImport(spec.FileSet, spec.File, pkg.ImportPath)
+	} else {
+		astutil.AddNamedImport(spec.FileSet, spec.File, pkg.Name, pkg.ImportPath)
+	}
+
+	//Only stop generating once every implementation has been migrated
+	if !failed {
+		removeGenerateDirectives(spec.File, genericPath)
+	}
+
+	writeMigratedFile(spec, specFile, dryRun)
+
+	for name, files := range generated {
+		if _, migrated := aliases[name]; !migrated {
+			continue
+		}
+		for _, file := range files {
+			if _, err := os.Stat(file); err != nil {
+				continue
+			}
+			if dryRun {
+				fmt.Printf("Would remove %s\n", file)
+			} else if err := os.Remove(file); err != nil {
+				printErrors([]error{err})
+			}
+		}
+	}
+}
+
+//Find a method on the named type that is declared in a file other than the given ones
+func methodsDeclaredOutside(c *Context, typeName string, files []string) (file string, declared bool) {
+	if c.Package == nil {
+		return
+	}
+
+	for file, f := range c.Package.Files {
+		if containsString(files, file) {
+			continue
+		}
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok {
+				if rcvr, isMethod := methodRecieverTypeIdentifier(fn); isMethod && rcvr == typeName {
+					return file, true
+				}
+			}
+		}
+	}
+	return
+}
+
+func writeMigratedFile(c *Context, file string, dryRun bool) {
+	var b bytes.Buffer
+	if err := format.Node(&b, c.FileSet, c.File); err != nil {
+		printErrors([]error{err})
+		return
+	}
+
+	if dryRun {
+		fmt.Printf("// %s\n%s\n", file, b.String())
+		return
+	}
+
+	if err := ioutil.WriteFile(file, b.Bytes(), 0644); err != nil {
+		printErrors([]error{err})
+		return
+	}
+	fmt.Printf("Migrated %s\n", file)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"strings"
+	"testing"
+)
+
+type MigrateTest struct {
+	Gen    string
+	Expect []string
+}
+
+func Test_MigrateGeneric(t *testing.T) {
+	tests := []MigrateTest{
+		{`type T interface{}
+		  type Slice []T
+		  func (s Slice) Where(fn func(T) bool) (result Slice) {
+		  	for _, v := range s {
+		  		if fn(v) {
+		  			result = append(result, v)
+		  		}
+		  	}
+		  	return
+		  }`,
+			[]string{"type Slice[T any] []T", "func (s Slice[T]) Where(fn func(T) bool) (result Slice[T])"}},
+		{`type K interface{}
+		  type V interface{}
+		  type Map map[K]V
+		  type Keys []K
+		  func Collect(m Map) (keys Keys) {
+		  	for k := range m {
+		  		keys = append(keys, k)
+		  	}
+		  	return
+		  }`,
+			[]string{"type Map[K comparable, V any] map[K]V", "type Keys[K comparable] []K", "func Collect[K comparable, V any](m Map[K, V]) (keys Keys[K])"}},
+		{`type I interface{}
+		  type Slice []I
+		  type _Sorter struct {
+		  	Slice
+		  	LessFunc func(I, I) bool
+		  }
+		  func (s Slice) Sort(less func(I, I) bool) {
+		  	sort.Sort(_Sorter{s, less})
+		  }`,
+			[]string{"type Sorter[I any] struct {", "\tSlice[I]\n", "sort.Sort(Sorter[I]{s, less})"}},
+	}
+
+	for _, tst := range tests {
+		gen, err := NewSourceStringContext("package gen\n"+tst.Gen, "gen.go")
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if errors := MigrateGeneric(gen); len(errors) != 0 {
+			t.Error(errors)
+			continue
+		}
+
+		var b bytes.Buffer
+		if err := format.Node(&b, gen.FileSet, gen.File); err != nil {
+			t.Error(err)
+			continue
+		}
+
+		src := b.String()
+		for _, expect := range tst.Expect {
+			if !strings.Contains(src, expect) {
+				t.Errorf("Expected %q in migrated source:\n%s", expect, src)
+			}
+		}
+		if strings.Contains(src, "interface{}") {
+			t.Errorf("Type parameter declarations were not removed:\n%s", src)
+		}
+	}
+}
+
+func Test_MigrateGenericErrors(t *testing.T) {
+	tests := []string{
+		`type T interface{}
+		 type U interface{}
+		 type Slice []T
+		 func (s Slice) Map(fn func(T) U) []U { return nil }`,
+		`type T interface{}
+		 const N = 1
+		 type Vec [N]T`,
+		`type Quittable struct{ quit chan bool }`,
+	}
+
+	for _, src := range tests {
+		gen, err := NewSourceStringContext("package gen\n"+src, "gen.go")
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if errors := MigrateGeneric(gen); len(errors) == 0 {
+			t.Errorf("Expected migration to fail:\n%s", src)
+		}
+	}
+}
+
+func Test_MigrateInstantiations(t *testing.T) {
+	tests := []MigrateTest{
+		{`type T interface{}
+		  type Slice []T`, []string{"type Ints = iter.Slice[int]"}},
+		{`type Slice[T any] []T`, []string{"type Ints = iter.Slice[int]"}},
+		{`type Map[V any, K comparable] map[K]V`, []string{"type Ages = iter.Map[int, string]"}},
+	}
+
+	for _, tst := range tests {
+		gen, _ := NewSourceStringContext("package iter\n"+tst.Gen, "iter.go")
+
+		spec, _ := NewSourceStringContext(`package main
+			type Ints []int
+			type Ages map[string]int
+			type Counter struct{ n int }`, "main.go")
+
+		insts, errors := MigrateInstantiations(gen, spec, "iter")
+		if len(errors) != 0 || len(insts) != 1 {
+			t.Errorf("Expected one instantiation, found %d. Errors: %v", len(insts), errors)
+			continue
+		}
+
+		if !insts[0].Apply(spec.File) {
+			t.Error("Failed to apply instantiation")
+			continue
+		}
+
+		var b bytes.Buffer
+		format.Node(&b, spec.FileSet, spec.File)
+		for _, expect := range tst.Expect {
+			if src := b.String(); !strings.Contains(src, expect) {
+				t.Errorf("Expected %q in migrated source:\n%s", expect, src)
+			}
+		}
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+//Generates a fake for each interface in a spec file. Fakes call a function field for each method, when it's set,
+//and record the arguments of every call, e.g. for
+//	type Store interface{ Get(key string) ([]byte, error) }
+//FakeStore has GetFunc func(key string) ([]byte, error), and GetCalls []FakeStoreGetCall that records each key
+//Parameter and result types are copied from the interface, so fakes need no reflection or type assertions
+type Mocker struct {
+	methodResolver
+	//Interfaces to generate fakes of. Every interface in the spec file when empty
+	Types []string
+}
+
+func NewMocker(pkg *Context, dir string, types []string) *Mocker {
+	return &Mocker{newMethodResolver(pkg, dir), types}
+}
+
+func (m *Mocker) Transform(spec *Context) (codes SourceSet, ok bool, errors []error) {
+	var types typeSet = spec.Types()
+	types.Each(func(t *ast.TypeSpec) {
+		iface, isInterface := t.Type.(*ast.InterfaceType)
+		if !isInterface || t.TypeParams != nil || (len(m.Types) != 0 && !containsString(m.Types, t.Name.Name)) {
+			return
+		}
+		if m.constraintOnly(m.Package, iface, map[string]bool{}) {
+			return
+		}
+
+		source, err := m.fake(t.Name.Name)
+		if err != nil {
+			errors = append(errors, err)
+		} else {
+			codes = append(codes, source)
+		}
+	})
+
+	if len(codes) == 0 && len(errors) == 0 {
+		errors = append(errors, fmt.Errorf("No interface in %s to generate a fake of", spec.File.Name.Name))
+	}
+	//An interface that can't be faked is reported on its own, the fakes of the others are still written
+	ok = len(codes) != 0
+	return
+}
+
+//Interfaces with type terms or comparable can only constrain type parameters, so there are no values to fake
+func (m *Mocker) constraintOnly(ctx *Context, iface *ast.InterfaceType, seen map[string]bool) bool {
+	for _, field := range iface.Methods.List {
+		if len(field.Names) != 0 {
+			continue
+		}
+		switch t := field.Type.(type) {
+		case *ast.UnaryExpr, *ast.BinaryExpr:
+			return true
+		case *ast.Ident:
+			spec, isType := ctx.LookupType(t.Name)
+			if !isType {
+				//Predeclared types other than error and any are type terms, as is comparable
+				if t.Name != "error" && t.Name != "any" {
+					return true
+				}
+				continue
+			}
+			embedded, isInterface := spec.Type.(*ast.InterfaceType)
+			if !isInterface {
+				return true
+			}
+			if !seen[t.Name] {
+				seen[t.Name] = true
+				if m.constraintOnly(ctx, embedded, seen) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+//The name of the fake of an interface, exported only if the interface is
+func fakeName(name string) string {
+	if ast.IsExported(name) {
+		return "Fake" + name
+	}
+	return "fake" + strings.Title(name)
+}
+
+func (m *Mocker) fake(name string) (source *SourceCode, err error) {
+	methods, err := m.methodsOf(m.Package, nil, ast.NewIdent(name), map[string]bool{})
+	if err != nil {
+		return nil, fmt.Errorf("Cannot generate a fake of %s: %s", name, err)
+	}
+	sort.SliceStable(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
+
+	var (
+		fake    = fakeName(name)
+		imports = ImportSpecs{{Path: &ast.BasicLit{Kind: token.STRING, Value: `"sync"`}}}
+		fields  bytes.Buffer
+		decls   bytes.Buffer
+	)
+
+	for n, method := range methods {
+		//Embedded interfaces may declare the same method
+		if n > 0 && methods[n-1].Name == method.Name {
+			continue
+		}
+		if method.From != nil && !ast.IsExported(method.Name) {
+			return nil, fmt.Errorf("Cannot generate a fake of %s: method %s is unexported in another package", name, method.Name)
+		}
+		imports = append(imports, method.imports()...)
+
+		sig := method.signature()
+		unnameResults(sig)
+		reserved := []string{"f", "fn"}
+		if sig.Results != nil {
+			for n := range sig.Results.List {
+				reserved = append(reserved, fmt.Sprintf("r%d", n))
+			}
+		}
+		args := nameParams(sig, reserved...)
+		call := fake + callFieldName(method.Name) + "Call"
+
+		fmt.Fprintf(&fields, "\t%sFunc %s\n", method.Name, ExprString(sig))
+		fmt.Fprintf(&fields, "\t%sCalls []%s\n", method.Name, call)
+
+		//Each call records its arguments in a struct with a field for each parameter
+		recordedFields := []string{}
+		for _, field := range sig.Params.List {
+			for _, id := range field.Names {
+				recordedFields = append(recordedFields, callFieldName(id.Name)+" "+ExprString(recordedType(field.Type)))
+			}
+		}
+		if len(recordedFields) == 0 {
+			fmt.Fprintf(&decls, "\ntype %s struct{}\n", call)
+		} else {
+			fmt.Fprintf(&decls, "\ntype %s struct {\n\t%s\n}\n", call, strings.Join(recordedFields, "\n\t"))
+		}
+
+		recorded := strings.Replace(strings.Join(args, ", "), "...", "", -1)
+		fmt.Fprintf(&decls, "\nfunc (f *%s) %s%s {\n", fake, method.Name, strings.TrimPrefix(ExprString(sig), "func"))
+		fmt.Fprintf(&decls, "\tf.mu.Lock()\n\tf.%sCalls = append(f.%sCalls, %s{%s})\n\tfn := f.%sFunc\n\tf.mu.Unlock()\n\n",
+			method.Name, method.Name, call, recorded, method.Name)
+		if sig.Results == nil || sig.Results.NumFields() == 0 {
+			fmt.Fprintf(&decls, "\tif fn != nil {\n\t\tfn(%s)\n\t}\n}\n", strings.Join(args, ", "))
+			continue
+		}
+
+		//Without a function, a fake returns the zero value of each result
+		zeros := []string{}
+		for n, field := range sig.Results.List {
+			zero := fmt.Sprintf("r%d", n)
+			fmt.Fprintf(&decls, "\tvar %s %s\n", zero, ExprString(field.Type))
+			zeros = append(zeros, zero)
+		}
+		fmt.Fprintf(&decls, "\tif fn == nil {\n\t\treturn %s\n\t}\n\treturn fn(%s)\n}\n", strings.Join(zeros, ", "), strings.Join(args, ", "))
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "\ntype %s struct {\n%s\n\tmu sync.Mutex\n}\n\n", fake, fields.String())
+	fmt.Fprintf(&b, "var _ %s = &%s{}\n", name, fake)
+	b.Write(decls.Bytes())
+
+	if source, err = generatedSource(m.Package, name, imports, b.Bytes()); err != nil {
+		err = fmt.Errorf("Cannot generate a fake of %s: %s", name, err)
+	}
+	return
+}
+
+//Calls record each argument in an exported field named after its parameter, and are named after their method
+func callFieldName(param string) string {
+	r := []rune(param)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+//Variadic arguments are recorded as the slice they're passed as
+func recordedType(x ast.Expr) ast.Expr {
+	if ellipsis, isVariadic := x.(*ast.Ellipsis); isVariadic {
+		return &ast.ArrayType{Elt: ellipsis.Elt}
+	}
+	return x
+}
+
+//Generate fakes of the interfaces in a spec file, written next to it
+func mock(specFile string, targets []string, cfg writeConfig) {
+	fmt.Printf("Mock %s\n", specFile)
+	cfg.Types = targets
+	transformSpec(specFile, "mock.go", cfg, func(pkg *Context, dir string) AstTransform {
+		return NewMocker(pkg, dir, targets)
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const mockSpec = `package app
+
+import (
+	"io"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	Sleep(time time.Duration, _ int, arg1 string) time.Time
+}
+
+type store interface {
+	io.Closer
+	Put(string, ...[]byte) (n int, err error)
+	Close() error
+}
+
+type Point struct{ X, Y int }
+`
+
+func Test_Mock(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+	writeTestFiles(dir, map[string]string{"app/app.go": mockSpec})
+	specFile := filepath.Join(dir, "app", "app.go")
+
+	spec, _ := NewFileContext(specFile)
+	pkg, _ := NewPackageContext(specFile, func(string) bool { return false })
+	codes, ok, errors := NewMocker(pkg, filepath.Dir(specFile), nil).Transform(spec)
+	if !ok || len(codes) != 2 {
+		t.Fatalf("Expected a fake of each interface, found %d %v", len(codes), errors)
+	}
+
+	tests := []struct {
+		Name   string
+		Expect []string
+	}{
+		{"Clock", []string{
+			"import (\n\t\"sync\"\n\t\"time\"\n)",
+			"\tAfterFunc  func(d time.Duration) <-chan time.Time\n\tAfterCalls []FakeClockAfterCall\n",
+			"type FakeClockAfterCall struct {\n\tD time.Duration\n}",
+			"type FakeClockNowCall struct{}",
+			"var _ Clock = &FakeClock{}",
+			//Parameters are renamed when they'd hide a package or another parameter
+			"func (f *FakeClock) Sleep(arg0 time.Duration, arg1_1 int, arg1 string) time.Time {",
+			"func (f *FakeClock) Now() time.Time {\n\tf.mu.Lock()\n\tf.NowCalls = append(f.NowCalls, FakeClockNowCall{})\n\tfn := f.NowFunc\n\tf.mu.Unlock()\n\n\tvar r0 time.Time\n\tif fn == nil {\n\t\treturn r0\n\t}\n\treturn fn()\n}",
+		}},
+		{"store", []string{
+			"type fakeStore struct",
+			"type fakeStorePutCall struct {\n\tArg0 string\n\tArg1 [][]byte\n}",
+			"func (f *fakeStore) Put(arg0 string, arg1 ...[]byte) (int, error) {",
+			"fakeStorePutCall{arg0, arg1}",
+			"return fn(arg0, arg1...)",
+		}},
+	}
+
+	for _, tst := range tests {
+		code, found := codes.First(func(s *SourceCode) bool { return s.Name == tst.Name })
+		if !found {
+			t.Errorf("Expected a fake of %s", tst.Name)
+			continue
+		}
+
+		var b bytes.Buffer
+		format.Node(&b, code.FileSet, code.File)
+		src := b.String()
+		for _, expect := range tst.Expect {
+			if !strings.Contains(src, expect) {
+				t.Errorf("Expected the fake of %s to contain\n%s\nfound\n%s", tst.Name, expect, src)
+			}
+		}
+		if strings.Count(src, ") Close() error") > 1 {
+			t.Errorf("Expected methods declared twice to be faked once, found\n%s", src)
+		}
+	}
+
+	for _, code := range codes {
+		code.Name = strings.ToLower(code.Name) + "_mock.go"
+		writeFormattedSourceToFile(code, filepath.Join(dir, "app"))
+	}
+	if err := typeCheckDir(filepath.Join(dir, "app")); err != nil {
+		t.Errorf("Expected the fakes to compile, found %s", err)
+	}
+}
+
+func Test_MockTypeSets(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+	writeTestFiles(dir, map[string]string{"app/app.go": `package app
+
+type Coded interface {
+	error
+	Code() int
+}
+
+type Number interface{ ~int | ~float64 }
+
+type Keyed interface {
+	comparable
+	Key() string
+}
+
+type Real interface{ Number }
+
+type Remote interface{ missing.Store }
+`})
+	specFile := filepath.Join(dir, "app", "app.go")
+
+	spec, _ := NewFileContext(specFile)
+	pkg, _ := NewPackageContext(specFile, func(string) bool { return false })
+	codes, ok, errors := NewMocker(pkg, filepath.Dir(specFile), nil).Transform(spec)
+	if !ok || len(codes) != 1 || codes[0].Name != "Coded" {
+		t.Fatalf("Expected only a fake of Coded, found %d %v", len(codes), errors)
+	}
+	if len(errors) != 1 || !strings.Contains(errors[0].Error(), "Remote") {
+		t.Errorf("Expected only the fake of Remote to fail, found %v", errors)
+	}
+
+	//The other fakes are still written when one of them fails
+	mock(specFile, nil, writeConfig{})
+	if !fileExists(filepath.Join(dir, "app", "coded_mock.go")) {
+		t.Fatal("Expected the fake of Coded to be written")
+	}
+	os.Remove(specFile)
+	writeTestFiles(dir, map[string]string{"app/app.go": "package app\n\ntype Coded interface {\n\terror\n\tCode() int\n}\n"})
+	if err := typeCheckDir(filepath.Join(dir, "app")); err != nil {
+		t.Errorf("Expected the fake of Coded to compile, found %s", err)
+	}
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+//What a plugin is sent on stdin
+//File is the spec file's AST: every node is an object whose "Node" field is the name of its go/ast type, e.g. "TypeSpec",
+//along with that type's fields. Positions and resolved objects are left out, tokens such as operators are strings,
+//and comment groups are their text
+type pluginRequest struct {
+	Version string      `json:"version"`
+	Args    []string    `json:"args"`
+	Spec    string      `json:"spec"`
+	Source  string      `json:"source"`
+	File    interface{} `json:"file"`
+}
+
+//What a plugin writes to stdout. Files are Go source named by the file they are written to,
+//and goast puts them in the spec's package and adds the imports they use from the spec file
+type pluginResponse struct {
+	Files  []pluginFile `json:"files"`
+	Errors []string     `json:"errors,omitempty"`
+}
+
+type pluginFile struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+//An AstTransform run by an external executable, see pluginRequest
+type pluginTransform struct {
+	Path string
+	Spec string
+	Args []string
+}
+
+//Global flags that take a value, which may be given as the next argument: goast --tags foo write ...
+var globalValueFlags = []string{"tags"}
+
+//The arguments after the global flags that come before a command, along with their values
+func skipGlobalFlags(args []string) []string {
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		flag, _, hasValue := strings.Cut(strings.TrimLeft(args[0], "-"), "=")
+		args = args[1:]
+		if !hasValue && containsString(globalValueFlags, flag) && len(args) > 0 {
+			args = args[1:]
+		}
+	}
+	return args
+}
+
+//The plugin and its arguments when args are goast write <name>, skipping any global flags before write
+//Builtin commands are the write commands goast implements itself, any other goast write <name> runs the plugin goast-<name>
+func pluginCommand(args, builtin []string) (name string, rest []string, ok bool) {
+	args = skipGlobalFlags(args)
+	if len(args) < 2 || args[0] != "write" || strings.HasPrefix(args[1], "-") || containsString(builtin, args[1]) {
+		return
+	}
+	return args[1], args[2:], true
+}
+
+func (p pluginTransform) Transform(c *Context) (codes SourceSet, ok bool, errors []error) {
+	var source bytes.Buffer
+	format.Node(&source, c.FileSet, c.File)
+
+	request, err := json.Marshal(pluginRequest{VERSION, p.Args, p.Spec, source.String(), astJSON(reflect.ValueOf(c.File))})
+	if err != nil {
+		return nil, false, []error{err}
+	}
+
+	var out bytes.Buffer
+	cmd := exec.Command(p.Path, p.Args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(request), &out, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, false, []error{fmt.Errorf("%s failed: %s", filepath.Base(p.Path), err)}
+	}
+
+	var response pluginResponse
+	if err := json.Unmarshal(out.Bytes(), &response); err != nil {
+		return nil, false, []error{fmt.Errorf("%s responded with invalid JSON: %s", filepath.Base(p.Path), err)}
+	}
+	for _, e := range response.Errors {
+		errors = append(errors, fmt.Errorf("%s: %s", filepath.Base(p.Path), e))
+	}
+
+	for _, f := range response.Files {
+		if f.Name != filepath.Base(f.Name) || !strings.HasSuffix(f.Name, ".go") {
+			errors = append(errors, fmt.Errorf("%s: invalid file name %s, expected a .go file name without a directory", filepath.Base(p.Path), f.Name))
+			continue
+		}
+
+		generated, err := NewSourceStringContext(f.Source, f.Name)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("%s: %s", filepath.Base(p.Path), err))
+			continue
+		}
+
+		generated.SetPackage(c.File.Name.Name)
+		addSpecImports(generated, c)
+		codes = append(codes, &SourceCode{generated, f.Name})
+	}
+
+	ok = len(errors) == 0
+	return
+}
+
+//Import the packages that generated code refers to by the names the spec file imports them as
+func addSpecImports(generated, spec *Context) {
+	ast.Inspect(generated.File, func(node ast.Node) bool {
+		sel, isSelector := node.(*ast.SelectorExpr)
+		if !isSelector {
+			return true
+		}
+
+		id, isIdent := sel.X.(*ast.Ident)
+		if !isIdent || id.Obj != nil {
+			return true
+		}
+
+		if _, imported := generated.LookupImport(id.Name); imported {
+			return true
+		}
+		if i, found := spec.LookupImport(id.Name); found {
+			generated.AddImportFromSpec(i)
+		}
+		return true
+	})
+}
+
+var (
+	posType    = reflect.TypeOf(token.NoPos)
+	objectType = reflect.TypeOf(&ast.Object{})
+	scopeType  = reflect.TypeOf(&ast.Scope{})
+)
+
+//The JSON form of an AST, see pluginRequest
+func astJSON(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		if cg, isComment := v.Interface().(*ast.CommentGroup); isComment {
+			return cg.Text()
+		}
+		return astJSON(v.Elem())
+
+	case reflect.Struct:
+		node := map[string]interface{}{"Node": v.Type().Name()}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			switch {
+			case field.Type == posType || field.Type == objectType || field.Type == scopeType:
+				continue
+			//File declarations already hold its imports, and comments are kept with what they document
+			case v.Type() == reflect.TypeOf(ast.File{}) && (field.Name == "Imports" || field.Name == "Unresolved" || field.Name == "Comments"):
+				continue
+			}
+			node[field.Name] = astJSON(v.Field(i))
+		}
+		return node
+
+	case reflect.Slice:
+		list := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			list = append(list, astJSON(v.Index(i)))
+		}
+		return list
+	}
+
+	if tok, isToken := v.Interface().(token.Token); isToken {
+		return tok.String()
+	}
+	return v.Interface()
+}
+
+//Run goast-<name> on a spec file, writing the files it generates next to the spec file or into --out-dir
+//The first .go argument is the spec file, defaulting to $GOFILE, and every other argument is passed to the plugin
+func runPlugin(name string, args []string) {
+	path, err := exec.LookPath("goast-" + name)
+	if err != nil {
+		fmt.Printf("Error: unknown command write %s, and no goast-%s plugin was found\n", name, name)
+		return
+	}
+
+	var (
+		p               = pluginTransform{Path: path, Spec: os.Getenv("GOFILE")}
+		specGiven       bool
+		outputDirectory string
+	)
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--out-dir" && i+1 < len(args):
+			i++
+			outputDirectory = args[i]
+		case strings.HasPrefix(args[i], "--out-dir="):
+			outputDirectory = strings.TrimPrefix(args[i], "--out-dir=")
+		case strings.HasSuffix(args[i], ".go") && !strings.HasPrefix(args[i], "-") && !specGiven:
+			p.Spec, specGiven = args[i], true
+		default:
+			p.Args = append(p.Args, args[i])
+		}
+	}
+
+	if p.Spec == "" {
+		fmt.Println("Error: no spec file given, and $GOFILE is not set")
+		return
+	}
+	if outputDirectory == "" {
+		outputDirectory = filepath.Dir(p.Spec)
+	}
+
+	spec, err := NewFileCommentContext(p.Spec)
+	if err != nil {
+		printErrors([]error{err})
+		return
+	}
+
+	fmt.Printf("Write %s on %s\n", name, p.Spec)
+	codes, ok, errors := p.Transform(spec)
+	if !ok {
+		printErrors(errors)
+		return
+	}
+	written := []string{}
+	for _, code := range codes {
+		writeFormattedSourceToFile(code, outputDirectory)
+		written = append(written, code.Name)
+	}
+	printErrors(recordOutputs(outputDirectory, p.entry(name, outputDirectory), written))
+}
+
+//Plugins are recorded like transforms, along with the command that ran them, see transformOutputs
+func (p pluginTransform) entry(name, outputDirectory string) manifestEntry {
+	return manifestEntry{
+		Directive: generateDirective + " " + name,
+		Job:       generateJob{Generic: strings.Join(append([]string{"goast-" + name}, p.Args...), " "), Spec: relativeTo(outputDirectory, p.Spec)},
+	}
+}
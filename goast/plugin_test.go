@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func Test_PluginCommand(t *testing.T) {
+	tests := []struct {
+		Args     []string
+		Name     string
+		Rest     []string
+		IsPlugin bool
+	}{
+		{[]string{"write", "impl", "goast.net/x/iter"}, "", nil, false},
+		{[]string{"write", "--help"}, "", nil, false},
+		{[]string{"generate"}, "", nil, false},
+		{[]string{"write", "json", "users.go", "--omitempty"}, "json", []string{"users.go", "--omitempty"}, true},
+		{[]string{"--tags=linux", "write", "json"}, "json", []string{}, true},
+		{[]string{"--tags", "linux", "write", "json"}, "json", []string{}, true},
+		{[]string{"--tags", "linux", "write", "impl"}, "", nil, false},
+	}
+
+	for _, tst := range tests {
+		name, rest, isPlugin := pluginCommand(tst.Args, []string{"impl", "deepcopy"})
+		if name != tst.Name || isPlugin != tst.IsPlugin || (isPlugin && !reflect.DeepEqual(rest, tst.Rest)) {
+			t.Errorf("Expected %v to be plugin %q %v %v, found %q %v %v", tst.Args, tst.Name, tst.Rest, tst.IsPlugin, name, rest, isPlugin)
+		}
+	}
+}
+
+func Test_AstJSON(t *testing.T) {
+	c, _ := NewSourceStringContext("package spec\ntype Names []string", "spec.go")
+
+	b, _ := json.Marshal(astJSON(reflect.ValueOf(c.File.Decls[0])))
+	expect := `{"Doc":null,"Node":"GenDecl","Specs":[{"Comment":null,"Doc":null,"Name":{"Name":"Names","Node":"Ident"},"Node":"TypeSpec","Type":{"Elt":{"Name":"string","Node":"Ident"},"Len":null,"Node":"ArrayType"},"TypeParams":null}],"Tok":"type"}`
+	if string(b) != expect {
+		t.Errorf("Expected %s, found %s", expect, b)
+	}
+}
+
+func Test_PluginTransform(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test plugin is a shell script")
+	}
+
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	//The plugin only generates when it's sent the arguments and spec types it expects
+	writeTestFiles(dir, map[string]string{
+		"goast-timeout": `#!/bin/sh
+request=$(cat)
+case "$request" in
+*'"args":["--seconds"]'*'"Name":"Timeout"'*) ;;
+*) echo '{"errors": ["unexpected request"]}'; exit 0 ;;
+esac
+printf '%s' '{"files": [{"name": "timeout_gen.go", "source": "package gen\nfunc (t Timeout) Duration() time.Duration { return time.Duration(t) * time.Second }"}]}'
+`,
+	})
+	os.Chmod(filepath.Join(dir, "goast-timeout"), 0755)
+
+	spec, _ := NewSourceStringContext("package app\nimport \"time\"\ntype Timeout int\nvar _ time.Duration", "app.go")
+	p := pluginTransform{Path: filepath.Join(dir, "goast-timeout"), Spec: "app.go", Args: []string{"--seconds"}}
+
+	codes, ok, errors := p.Transform(spec)
+	if !ok || len(codes) != 1 {
+		t.Fatalf("Expected one file from the plugin, found %d %v", len(codes), errors)
+	}
+
+	if codes[0].Name != "timeout_gen.go" || codes[0].File.Name.Name != "app" {
+		t.Errorf("Expected timeout_gen.go in package app, found %s in %s", codes[0].Name, codes[0].File.Name.Name)
+	}
+	if _, imported := codes[0].LookupImport("time"); !imported {
+		t.Error("Expected the time import of the spec file to be added")
+	}
+
+	p.Args = nil
+	if _, ok, errors := p.Transform(spec); ok || len(errors) != 1 || !strings.Contains(errors[0].Error(), "unexpected request") {
+		t.Errorf("Expected the plugin's errors to be reported, found %v", errors)
+	}
+}
+
+func Test_PluginManifest(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test plugin is a shell script")
+	}
+
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	writeTestFiles(dir, map[string]string{
+		"bin/goast-stub": `#!/bin/sh
+cat > /dev/null
+printf '%s' '{"files": [{"name": "stub_gen.go", "source": "package gen\nfunc Stub() {}"}]}'
+`,
+		"app/app.go": "package app\n//go:generate goast write stub\ntype Stub int",
+	})
+	os.Chmod(filepath.Join(dir, "bin", "goast-stub"), 0755)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", filepath.Join(dir, "bin"))
+
+	runPlugin("stub", []string{filepath.Join(dir, "app", "app.go")})
+	m, err := loadManifest(filepath.Join(dir, "app"))
+	if err != nil || len(m.Entries) != 1 || !reflect.DeepEqual(m.Entries[0].Files, []string{"stub_gen.go"}) {
+		t.Fatalf("Expected the plugin's output to be recorded, found %v %v", m, err)
+	}
+
+	pattern := filepath.Join(dir, "app") + "/..."
+	clean(pattern, false)
+	if !fileExists(filepath.Join(dir, "app", "stub_gen.go")) {
+		t.Error("Expected clean to keep the output of a plugin that is still run")
+	}
+
+	writeTestFiles(dir, map[string]string{"app/app.go": "package app\ntype Stub int"})
+	clean(pattern, false)
+	if fileExists(filepath.Join(dir, "app", "stub_gen.go")) {
+		t.Error("Expected clean to remove the output of a plugin that is no longer run")
+	}
+}
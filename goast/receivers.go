@@ -0,0 +1,572 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+//Receiver policies, for the methods generated on spec types
+//	pointer: every method has a pointer receiver
+//	value: every method has a value receiver
+//	match: methods have the receivers the spec type's own methods have, if it has any
+//Without a policy, methods keep the receivers the generic declares them with
+const (
+	pointerReceivers = "pointer"
+	valueReceivers   = "value"
+	matchReceivers   = "match"
+)
+
+//A generic file can give its own default policy, before its declarations
+//	//goast:receivers pointer
+//	package bank
+const receiversDirective = "//goast:receivers"
+
+func validReceivers(policy string) error {
+	switch policy {
+	case "", pointerReceivers, valueReceivers, matchReceivers:
+		return nil
+	default:
+		return fmt.Errorf("Unknown receivers %s, expected %s, %s or %s", policy, pointerReceivers, valueReceivers, matchReceivers)
+	}
+}
+
+//The receiver policy a job implements a generic file with: the job's own, or else the file's directive
+func receiverPolicy(job generateJob, genericFile string) (policy string, err error) {
+	if job.Receivers != "" {
+		return job.Receivers, validReceivers(job.Receivers)
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), genericFile, nil, parser.ParseComments|parser.ImportsOnly)
+	if err != nil {
+		return
+	}
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			if strings.HasPrefix(c.Text, receiversDirective+" ") {
+				policy = strings.TrimSpace(strings.TrimPrefix(c.Text, receiversDirective))
+				if err = validReceivers(policy); err != nil {
+					err = fmt.Errorf("%s: %s", genericFile, err)
+				}
+				return
+			}
+		}
+	}
+	return
+}
+
+//Whether the methods on a generic type bound to a spec type get pointer receivers, and whether the policy changes them at all
+func (imp *Implementor) receiverKind(x ast.Expr) (pointer, change bool) {
+	spec, ok := x.(*ast.Ident)
+	if !ok || isDerived(x) {
+		return
+	}
+
+	switch imp.Receivers {
+	case pointerReceivers:
+		return true, true
+	case valueReceivers:
+		return false, true
+	case matchReceivers:
+		hasPointer, hasValue := receiverKindsOf(imp.TypeProvider, spec.Name)
+		return hasPointer, hasPointer || hasValue
+	}
+	return
+}
+
+//The kinds of receiver a spec type's methods have
+func receiverKindsOf(pkg *Context, name string) (pointer, value bool) {
+	for _, f := range pkg.Funcs() {
+		if recvName, ok := methodRecieverTypeIdentifier(f); ok && recvName == name {
+			if isPointer(f.Recv.List[0].Type) {
+				pointer = true
+			} else {
+				value = true
+			}
+		}
+	}
+	return
+}
+
+//Rewrite the receivers of the methods on generic types to the receiver policy, along with the uses of each receiver in
+//its method and the method expressions and composite literal calls that no longer compile
+//Value receivers that modify what used to be shared are warned about, as they now modify a copy
+func (imp *Implementor) applyReceivers(file *ast.File, imap ImplMap) (warnings []string) {
+	//Methods that were given pointer receivers, by generic type
+	pointered := map[string]map[string]*ast.FuncDecl{}
+
+	for _, f := range file.Decls {
+		f, ok := f.(*ast.FuncDecl)
+		if !ok || f.Body == nil {
+			continue
+		}
+		name, ok := methodRecieverTypeIdentifier(f)
+		if !ok {
+			continue
+		}
+		x, bound := imap[name]
+		if !bound {
+			continue
+		}
+		pointer, change := imp.receiverKind(x)
+		field := f.Recv.List[0]
+		if !change || pointer == isPointer(field.Type) {
+			continue
+		}
+
+		var recv *ast.Ident
+		if len(field.Names) != 0 && field.Names[0].Name != "_" {
+			recv = field.Names[0]
+		}
+
+		if pointer {
+			field.Type = &ast.StarExpr{X: field.Type}
+			if pointered[name] == nil {
+				pointered[name] = map[string]*ast.FuncDecl{}
+			}
+			pointered[name][f.Name.Name] = f
+			if recv != nil {
+				pointerReceiver(f, recv)
+			}
+			continue
+		}
+
+		field.Type = field.Type.(*ast.StarExpr).X
+		if recv != nil {
+			if mutates(f.Body, recv, false) {
+				warnings = append(warnings, fmt.Sprintf("%s.%s modifies its receiver, which is now a copy", ExprString(x), f.Name.Name))
+			}
+			valueReceiver(f, recv)
+		}
+	}
+
+	if len(pointered) != 0 {
+		warnings = append(warnings, pointerCallSites(file, pointered)...)
+	}
+	return
+}
+
+//Uses of a value receiver that became a pointer are dereferenced. A method that modifies its receiver works on a copy
+//instead, so it still leaves the original alone
+func pointerReceiver(f *ast.FuncDecl, recv *ast.Ident) {
+	if mutates(f.Body, recv, true) {
+		name := unusedName(f.Body, recv.Name+"Ptr")
+		copied := &ast.AssignStmt{
+			Lhs: []ast.Expr{ast.NewIdent(recv.Name)},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{&ast.StarExpr{X: ast.NewIdent(name)}},
+		}
+		f.Recv.List[0].Names[0] = ast.NewIdent(name)
+		f.Body.List = append([]ast.Stmt{copied}, f.Body.List...)
+		return
+	}
+
+	astutil.Apply(f.Body, nil, func(c *astutil.Cursor) bool {
+		id, ok := c.Node().(*ast.Ident)
+		if !ok || !sameObject(id, recv) {
+			return true
+		}
+
+		//Fields and methods are selected through pointers implicitly
+		switch p := c.Parent().(type) {
+		case *ast.SelectorExpr:
+			if c.Name() == "X" {
+				return true
+			}
+		case *ast.KeyValueExpr:
+			if c.Name() == "Key" {
+				return true
+			}
+		case *ast.IndexExpr, *ast.SliceExpr, *ast.TypeAssertExpr:
+			c.Replace(&ast.ParenExpr{X: &ast.StarExpr{X: id}})
+			return true
+		case *ast.CallExpr:
+			if p.Fun == id {
+				c.Replace(&ast.ParenExpr{X: &ast.StarExpr{X: id}})
+				return true
+			}
+		}
+		c.Replace(&ast.StarExpr{X: id})
+		return true
+	})
+}
+
+//Dereferences of a pointer receiver that became a value are dropped, and its other uses take its address
+func valueReceiver(f *ast.FuncDecl, recv *ast.Ident) {
+	deref := func(x ast.Expr) (id *ast.Ident, ok bool) {
+		if star, isStar := x.(*ast.StarExpr); isStar {
+			id, ok = star.X.(*ast.Ident)
+			ok = ok && sameObject(id, recv)
+		}
+		return
+	}
+
+	astutil.Apply(f.Body, func(c *astutil.Cursor) bool {
+		switch t := c.Node().(type) {
+		case *ast.ParenExpr:
+			if id, ok := deref(t.X); ok {
+				c.Replace(id)
+				return false
+			}
+
+		case *ast.StarExpr:
+			if id, ok := deref(t); ok {
+				c.Replace(id)
+				return false
+			}
+
+		case *ast.Ident:
+			if !sameObject(t, recv) {
+				return true
+			}
+			switch c.Parent().(type) {
+			case *ast.SelectorExpr:
+				if c.Name() == "X" {
+					return true
+				}
+			case *ast.KeyValueExpr:
+				if c.Name() == "Key" {
+					return true
+				}
+			}
+			c.Replace(&ast.UnaryExpr{Op: token.AND, X: t})
+			return false
+		}
+		return true
+	}, nil)
+}
+
+//Method expressions and methods called on values that aren't addressable need an addressable receiver once the method
+//has a pointer receiver. Method expressions keep their type, so calls of them are left alone, while other values are
+//passed to a func literal that calls the method on its parameter, so they are still evaluated before the arguments
+//	Slice.Len -> func(s Slice) int { return s.Len() }
+//	Pair{k, v}.Swap() -> (&Pair{k, v}).Swap()
+//	Slice(s[1:]).Len() -> func(x Slice) int { return x.Len() }(Slice(s[1:]))
+func pointerCallSites(file *ast.File, pointered map[string]map[string]*ast.FuncDecl) (warnings []string) {
+	decls := genericDeclsOf(file)
+	astutil.Apply(file, func(c *astutil.Cursor) bool {
+		if call, ok := c.Node().(*ast.CallExpr); ok {
+			sel, isSel := call.Fun.(*ast.SelectorExpr)
+			if !isSel || addressable(sel.X, decls) {
+				return true
+			}
+			t, ok := decls.typeOf(sel.X).(*ast.Ident)
+			if !ok || pointered[t.Name][sel.Sel.Name] == nil {
+				return true
+			}
+			f := pointered[t.Name][sel.Sel.Name]
+			lit, ok := methodExprLit(t, f)
+			if !ok {
+				warnings = append(warnings, fmt.Sprintf("%s.%s can't be called on %s once it has a pointer receiver", t.Name, sel.Sel.Name, ExprString(sel.X)))
+				return true
+			}
+			c.Replace(&ast.CallExpr{Fun: lit, Args: append([]ast.Expr{sel.X}, call.Args...), Ellipsis: call.Ellipsis})
+			return true
+		}
+
+		sel, ok := c.Node().(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+
+		switch x := sel.X.(type) {
+		case *ast.Ident:
+			if f := pointered[x.Name][sel.Sel.Name]; f != nil && (x.Obj == nil || x.Obj.Kind == ast.Typ) {
+				if lit, ok := methodExprLit(x, f); ok {
+					c.Replace(lit)
+				} else {
+					sel.X = &ast.ParenExpr{X: &ast.StarExpr{X: x}}
+				}
+				return false
+			}
+
+		case *ast.CompositeLit:
+			if id, ok := x.Type.(*ast.Ident); ok && pointered[id.Name][sel.Sel.Name] != nil {
+				sel.X = &ast.ParenExpr{X: &ast.UnaryExpr{Op: token.AND, X: x}}
+			}
+		}
+		return true
+	}, nil)
+	return
+}
+
+//The functions and methods a generic file declares, to tell the types of the expressions that use them
+//Types are found through the identifiers that name them, as impl types have already been filtered out of the file
+type genericDecls struct {
+	funcs   map[string]*ast.FuncDecl
+	methods map[string]map[string]*ast.FuncDecl
+}
+
+func genericDeclsOf(file *ast.File) genericDecls {
+	d := genericDecls{map[string]*ast.FuncDecl{}, map[string]map[string]*ast.FuncDecl{}}
+	for _, decl := range file.Decls {
+		f, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if f.Recv == nil {
+			d.funcs[f.Name.Name] = f
+		} else if name, ok := methodRecieverTypeIdentifier(f); ok {
+			if d.methods[name] == nil {
+				d.methods[name] = map[string]*ast.FuncDecl{}
+			}
+			d.methods[name][f.Name.Name] = f
+		}
+	}
+	return d
+}
+
+//The type of an expression, as far as the declarations of the generic file tell, or nil when they don't
+func (d genericDecls) typeOf(x ast.Expr) ast.Expr {
+	switch t := x.(type) {
+	case *ast.ParenExpr:
+		return d.typeOf(t.X)
+
+	case *ast.StarExpr:
+		if star, ok := d.typeOf(t.X).(*ast.StarExpr); ok {
+			return star.X
+		}
+
+	case *ast.CompositeLit:
+		return t.Type
+
+	case *ast.IndexExpr:
+		switch indexed := underlying(d.typeOf(t.X)).(type) {
+		case *ast.MapType:
+			return indexed.Value
+		case *ast.ArrayType:
+			return indexed.Elt
+		}
+
+	case *ast.SliceExpr:
+		//Slicing a defined slice type keeps its type
+		if id, ok := d.typeOf(t.X).(*ast.Ident); ok {
+			if ts, ok := typeSpecOf(id); ok {
+				if _, isSlice := ts.Type.(*ast.ArrayType); isSlice {
+					return id
+				}
+			}
+		}
+
+	case *ast.Ident:
+		if t.Obj == nil {
+			return nil
+		}
+		switch decl := t.Obj.Decl.(type) {
+		case *ast.Field:
+			return decl.Type
+		case *ast.ValueSpec:
+			if decl.Type != nil {
+				return decl.Type
+			}
+		case *ast.AssignStmt:
+			for i, lhs := range decl.Lhs {
+				if id, ok := lhs.(*ast.Ident); ok && id.Name == t.Name && len(decl.Rhs) == len(decl.Lhs) && decl.Rhs[i] != x {
+					return d.typeOf(decl.Rhs[i])
+				}
+			}
+		}
+
+	case *ast.CallExpr:
+		var f *ast.FuncDecl
+		switch fun := t.Fun.(type) {
+		case *ast.Ident:
+			//Conversions to the file's types, or to the types it declares methods on
+			if _, ok := typeSpecOf(fun); ok || d.methods[fun.Name] != nil {
+				return fun
+			}
+			f = d.funcs[fun.Name]
+		case *ast.SelectorExpr:
+			recv := d.typeOf(fun.X)
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			if id, ok := recv.(*ast.Ident); ok {
+				f = d.methods[id.Name][fun.Sel.Name]
+			}
+		}
+		if f != nil && f.Type.Results.NumFields() == 1 {
+			return f.Type.Results.List[0].Type
+		}
+	}
+	return nil
+}
+
+//Whether an expression can have its address taken, as far as the declarations of the generic file tell
+//Composite literals are addressed when their methods are selected, so they are left out
+func addressable(x ast.Expr, d genericDecls) bool {
+	switch t := x.(type) {
+	case *ast.ParenExpr:
+		return addressable(t.X, d)
+	case *ast.CallExpr, *ast.SliceExpr:
+		return false
+	case *ast.IndexExpr:
+		//Map elements aren't addressable, elements of arrays are only if their array is
+		switch indexed := underlying(d.typeOf(t.X)).(type) {
+		case *ast.MapType:
+			return false
+		case *ast.ArrayType:
+			return indexed.Len == nil || addressable(t.X, d)
+		}
+	}
+	return true
+}
+
+//The type a type of the generic file is defined as
+func underlying(x ast.Expr) ast.Expr {
+	for seen := map[*ast.TypeSpec]bool{}; ; {
+		id, ok := x.(*ast.Ident)
+		if !ok {
+			return x
+		}
+		t, ok := typeSpecOf(id)
+		if !ok || seen[t] {
+			return x
+		}
+		seen[t] = true
+		x = t.Type
+	}
+}
+
+//A func literal of the type a method expression had before its method was given a pointer receiver
+//Variadic methods can't be forwarded to without positions for the ellipsis, so they aren't
+func methodExprLit(recv *ast.Ident, f *ast.FuncDecl) (lit *ast.FuncLit, ok bool) {
+	//Types are copied so the rewrite of generic types doesn't rewrite them twice
+	copyOf := func(x ast.Expr) ast.Expr {
+		copied, _ := substituteIdents(x, nil)
+		return copied
+	}
+
+	var (
+		params = []*ast.Field{{Names: []*ast.Ident{ast.NewIdent("x")}, Type: ast.NewIdent(recv.Name)}}
+		args   []ast.Expr
+	)
+	for _, field := range f.Type.Params.List {
+		if _, variadic := field.Type.(*ast.Ellipsis); variadic {
+			return
+		}
+		for i := 0; i < len(field.Names) || (i == 0 && len(field.Names) == 0); i++ {
+			name := ast.NewIdent(fmt.Sprintf("p%d", len(args)))
+			params = append(params, &ast.Field{Names: []*ast.Ident{name}, Type: copyOf(field.Type)})
+			args = append(args, ast.NewIdent(name.Name))
+		}
+	}
+
+	var (
+		results *ast.FieldList
+		call    = &ast.CallExpr{Fun: &ast.SelectorExpr{X: ast.NewIdent("x"), Sel: ast.NewIdent(f.Name.Name)}, Args: args}
+	)
+	var body ast.Stmt = &ast.ExprStmt{X: call}
+	if f.Type.Results.NumFields() != 0 {
+		results = &ast.FieldList{}
+		for _, field := range f.Type.Results.List {
+			for i := 0; i < len(field.Names) || (i == 0 && len(field.Names) == 0); i++ {
+				results.List = append(results.List, &ast.Field{Type: copyOf(field.Type)})
+			}
+		}
+		body = &ast.ReturnStmt{Results: []ast.Expr{call}}
+	}
+
+	lit = &ast.FuncLit{
+		Type: &ast.FuncType{Params: &ast.FieldList{List: params}, Results: results},
+		Body: &ast.BlockStmt{List: []ast.Stmt{body}},
+	}
+	return lit, true
+}
+
+//Whether a method body modifies its receiver through assignment, increments or taking its address
+//Modifying elements of a slice or map modifies what every copy shares, so isn't counted. With direct, so is
+//assigning to the receiver itself, otherwise only assigning through it is
+func mutates(body *ast.BlockStmt, recv *ast.Ident, direct bool) (mutated bool) {
+	assigns := func(x ast.Expr) bool {
+		id, indirect := assignedRoot(x)
+		return id != nil && sameObject(id, recv) && (direct || indirect)
+	}
+
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch t := node.(type) {
+		case *ast.AssignStmt:
+			if t.Tok != token.DEFINE {
+				for _, lhs := range t.Lhs {
+					mutated = mutated || assigns(lhs)
+				}
+			}
+
+		case *ast.IncDecStmt:
+			mutated = mutated || assigns(t.X)
+
+		case *ast.RangeStmt:
+			if t.Tok == token.ASSIGN {
+				mutated = mutated || (t.Key != nil && assigns(t.Key)) || (t.Value != nil && assigns(t.Value))
+			}
+
+		case *ast.UnaryExpr:
+			if id, _ := assignedRoot(t.X); t.Op == token.AND && id != nil && sameObject(id, recv) {
+				mutated = true
+			}
+		}
+		return !mutated
+	})
+	return
+}
+
+//The variable an assignment assigns to, and whether it assigns through it rather than to it
+func assignedRoot(x ast.Expr) (id *ast.Ident, indirect bool) {
+	for {
+		switch t := x.(type) {
+		case *ast.Ident:
+			return t, indirect
+		case *ast.ParenExpr:
+			x = t.X
+		case *ast.SelectorExpr:
+			x, indirect = t.X, true
+		case *ast.StarExpr:
+			x, indirect = t.X, true
+		default:
+			return nil, false
+		}
+	}
+}
+
+//Whether an identifier refers to a declared one, by object when the parser resolved it
+func sameObject(id, decl *ast.Ident) bool {
+	return id != decl && id.Name == decl.Name && (decl.Obj == nil || id.Obj == decl.Obj)
+}
+
+//A name that isn't used in a body, based on the one given
+func unusedName(body *ast.BlockStmt, name string) string {
+	used := map[string]bool{}
+	ast.Inspect(body, func(node ast.Node) bool {
+		if id, ok := node.(*ast.Ident); ok {
+			used[id.Name] = true
+		}
+		return true
+	})
+
+	unused := name
+	for i := 2; used[unused]; i++ {
+		unused = fmt.Sprintf("%s%d", name, i)
+	}
+	return unused
+}
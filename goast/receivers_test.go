@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const receiversGeneric = `package gen
+type T interface{}
+type Slice []T
+func (s Slice) First() T { return s[0] }
+func (s Slice) Push(v T) Slice {
+	s = append(s, v)
+	return s
+}
+func (s Slice) Lens() []int {
+	f := Slice.First
+	return []int{len(s), len(Slice{}.Push(f(s)))}
+}
+type Counter struct {
+	n int
+}
+func (c *Counter) Inc() { c.n++ }
+func (c *Counter) Get() int { return (*c).n }`
+
+func Test_Receivers(t *testing.T) {
+	tests := []struct {
+		Policy, Spec     string
+		Expect, Warnings []string
+	}{
+		{pointerReceivers, "",
+			[]string{"func (s *Ints) First() int", "return (*s)[0]", "func (sPtr *Ints) Push(v int) Ints", "s := *sPtr", "f := func(x Ints) int", "len((&Ints{}).Push(f(*s)))", "func (c *Hits) Inc()"},
+			nil},
+		{valueReceivers, "",
+			[]string{"func (s Ints) First() int", "func (c Hits) Inc()", "return c.n"},
+			[]string{"Hits.Inc modifies its receiver, which is now a copy"}},
+		{matchReceivers, "func (i *Ints) Add(v int) { *i = append(*i, v) }",
+			[]string{"func (s *Ints) First() int", "func (c *Hits) Inc()"},
+			nil},
+		{matchReceivers, "func (h Hits) String() string { return \"\" }",
+			[]string{"func (s Ints) First() int", "func (c Hits) Get() int"},
+			[]string{"Hits.Inc modifies its receiver, which is now a copy"}},
+		{"", "",
+			[]string{"func (s Ints) First() int", "f := Ints.First", "func (c *Hits) Get() int"},
+			nil},
+	}
+
+	for _, tst := range tests {
+		gen, _ := NewSourceStringContext(receiversGeneric, "gen.go")
+		spec, _ := NewSourceStringContext("package main\ntype Ints []int\ntype Hits struct{ n int }\n"+tst.Spec, "spec.go")
+		imp := NewImplementor(spec)
+		imp.Receivers = tst.Policy
+
+		codes, ok, errors := imp.Transform(gen)
+		if !ok {
+			t.Errorf("Expected %s receivers for %s, found %v", tst.Policy, tst.Spec, errors)
+			continue
+		}
+		var b bytes.Buffer
+		for _, code := range codes {
+			printer.Fprint(&b, token.NewFileSet(), code.File)
+		}
+		src := b.String()
+
+		for _, expect := range tst.Expect {
+			if !strings.Contains(src, expect) {
+				t.Errorf("Expected %q in implementation:\n%s", expect, src)
+			}
+		}
+		if strings.Join(imp.warnings, "\n") != strings.Join(tst.Warnings, "\n") {
+			t.Errorf("Expected warnings %v, found %v", tst.Warnings, imp.warnings)
+		}
+	}
+}
+
+func Test_ReceiverPolicy(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		Source, Job, Expect string
+		Valid               bool
+	}{
+		{"package gen\n", "", "", true},
+		{"//goast:receivers pointer\n\npackage gen\n", "", pointerReceivers, true},
+		{"//goast:receivers pointer\n\npackage gen\n", matchReceivers, matchReceivers, true},
+		{"package gen\n\n//goast:receivers value\n\nimport \"fmt\"\n", "", valueReceivers, true},
+		{"//goast:receivers copy\n\npackage gen\n", "", "", false},
+		{"package gen\n", "both", "", false},
+	}
+
+	genericFile := filepath.Join(dir, "gen.go")
+	for _, tst := range tests {
+		ioutil.WriteFile(genericFile, []byte(tst.Source), 0644)
+		policy, err := receiverPolicy(generateJob{Receivers: tst.Job}, genericFile)
+		if (err == nil) != tst.Valid || (tst.Valid && policy != tst.Expect) {
+			t.Errorf("Expected policy %q for %q with %q, found %q %v", tst.Expect, tst.Source, tst.Job, policy, err)
+		}
+	}
+}
+
+func Test_ReceiversUnaddressable(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	writeTestFiles(dir, map[string]string{
+		"gen/slice.go": `package gen
+type T interface{}
+type Slice []T
+type Index map[string]Slice
+func (s Slice) Len() int { return len(s) }
+func (s Slice) Where(fn func(T) bool) (result Slice) {
+	for _, v := range s {
+		if fn(v) {
+			result = append(result, v)
+		}
+	}
+	return
+}
+func (s Slice) Tail() int { return Slice(s[1:]).Len() + s[1:].Len() }
+func (s Slice) Count(fn func(T) bool) int {
+	matched := s.Where(fn)
+	return s.Where(fn).Len() + matched.Len()
+}
+func (s Slice) Lookup(i Index, key string) int { return i[key].Len() }`,
+		"app/main.go": "package main\ntype Ints []int\ntype Lookup map[string]Ints\nfunc main() {}",
+	})
+
+	job := generateJob{Generic: filepath.Join(dir, "gen", "slice.go"), Spec: filepath.Join(dir, "app", "main.go"), Receivers: pointerReceivers, Directive: generateDirective}
+	if errors := newGenerator(".", nil).Run(job); len(errors) != 0 {
+		t.Fatal(errors)
+	}
+
+	if err := typeCheckDir(filepath.Join(dir, "app")); err != nil {
+		b, _ := ioutil.ReadFile(filepath.Join(dir, "app", "lookup_slice.go"))
+		t.Errorf("Expected calls on values that aren't addressable to compile, found %s in:\n%s", err, b)
+	}
+}
@@ -0,0 +1,356 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+//Forms of generated methods on spec types, when they are generated into another package
+//Go only allows methods on types declared in the same package, so they become either
+//methods of a wrapper type declared in the generated package, e.g. type Ints users.Ints,
+//or free functions that take the spec type as their first parameter, e.g. func IntsWhere(s users.Ints, ...)
+const (
+	wrapperForm = "wrapper"
+	funcForm    = "func"
+)
+
+//The package implementations are generated into, when it isn't the spec package
+type outputPackage struct {
+	Name string
+	//Import path of the spec package, which generated code refers to spec types through
+	SpecPath string
+	Form     string
+}
+
+//Rewrite an implementation so that it can live in another package than its spec types
+func (imp *Implementor) relocate(ctx *Context) (errors []error) {
+	var (
+		out       = imp.Output
+		file      = ctx.File
+		specName  = imp.TypeProvider.File.Name.Name
+		declared  = topLevelNames(file)
+		receivers = specReceivers(file, imp.TypeProvider, declared)
+	)
+
+	if specName == "main" {
+		return []error{fmt.Errorf("Spec types in package main can't be used from package %s", out.Name)}
+	}
+
+	isSpecType := func(name string) bool {
+		_, isType := imp.TypeProvider.LookupType(name)
+		return isType && !declared[name]
+	}
+
+	switch out.Form {
+	case wrapperForm, "":
+		wrappers := []ast.Decl{}
+		for _, name := range receivers {
+			wrappers = append(wrappers, &ast.GenDecl{
+				Tok:   token.TYPE,
+				Specs: []ast.Spec{&ast.TypeSpec{Name: ast.NewIdent(name), Type: qualified(specName, name)}},
+			})
+			declared[name] = true
+		}
+
+		prependDecls(file, wrappers)
+
+	case funcForm:
+		if errors = methodsToFuncs(file, receivers); len(errors) != 0 {
+			return
+		}
+
+	default:
+		return []error{fmt.Errorf("Unknown form %s, expected %s or %s", out.Form, wrapperForm, funcForm)}
+	}
+
+	astutil.Apply(file, func(c *astutil.Cursor) bool {
+		id, ok := c.Node().(*ast.Ident)
+		if !ok || !isSpecType(id.Name) {
+			return true
+		}
+
+		//Identifiers in these positions are names being declared or selected, not uses of the type
+		switch c.Name() {
+		case "Sel", "Name", "Names", "Label":
+			return true
+		case "Key":
+			if _, isKeyValue := c.Parent().(*ast.KeyValueExpr); isKeyValue {
+				return true
+			}
+		}
+
+		if !ast.IsExported(id.Name) {
+			errors = append(errors, fmt.Errorf("%s is not exported, so it can't be used from package %s", id.Name, out.Name))
+			return true
+		}
+		c.Replace(qualified(specName, id.Name))
+		return true
+	}, nil)
+
+	if path.Base(out.SpecPath) == specName {
+		astutil.AddImport(ctx.FileSet, file, out.SpecPath)
+	} else {
+		astutil.AddNamedImport(ctx.FileSet, file, specName, out.SpecPath)
+	}
+	file.Name = ast.NewIdent(out.Name)
+	return
+}
+
+//Declare decls ahead of everything else in a file, but after its imports
+func prependDecls(file *ast.File, decls []ast.Decl) {
+	i := 0
+	for i < len(file.Decls) {
+		if g, ok := file.Decls[i].(*ast.GenDecl); !ok || g.Tok != token.IMPORT {
+			break
+		}
+		i++
+	}
+	file.Decls = append(file.Decls[:i], append(decls, file.Decls[i:]...)...)
+}
+
+func qualified(pkg, name string) *ast.SelectorExpr {
+	return &ast.SelectorExpr{X: ast.NewIdent(pkg), Sel: ast.NewIdent(name)}
+}
+
+//Every name declared at the top level of a file
+func topLevelNames(file *ast.File) map[string]bool {
+	names := map[string]bool{}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				names[d.Name.Name] = true
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					names[s.Name.Name] = true
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						names[name.Name] = true
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+//The spec types that methods are declared on, in a stable order
+func specReceivers(file *ast.File, spec *Context, declared map[string]bool) (names []string) {
+	found := map[string]bool{}
+	for _, f := range file.Decls {
+		fd, ok := f.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if name, ok := methodRecieverTypeIdentifier(fd); ok && !declared[name] && !found[name] {
+			if _, isType := spec.LookupType(name); isType {
+				found[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+//Turn methods on spec types into free functions, e.g. func (s Ints) Where(...) becomes func IntsWhere(s Ints, ...)
+//Calls of converted methods are rewritten wherever the type of the value they are called on can be told,
+//e.g. other.Len() becomes IntsLen(other), and s.Where(fn).Len() becomes IntsLen(IntsWhere(s, fn))
+//Anything else that uses a converted method is reported, as the method no longer exists
+func methodsToFuncs(file *ast.File, receivers []string) (errors []error) {
+	type conversion struct {
+		name    string
+		pointer bool
+	}
+	var (
+		converted = map[string]conversion{}
+		methods   = map[string]bool{}
+		decls     = genericDeclsOf(file)
+	)
+	funcName := func(rcvr, method string) string {
+		if ast.IsExported(method) {
+			return rcvr + method
+		}
+		r := []rune(rcvr)
+		r[0] = unicode.ToLower(r[0])
+		return string(r) + strings.Title(method)
+	}
+
+	for _, decl := range file.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok {
+			if rcvr, ok := methodRecieverTypeIdentifier(fd); ok && containsString(receivers, rcvr) {
+				_, pointer := fd.Recv.List[0].Type.(*ast.StarExpr)
+				converted[rcvr+"."+fd.Name.Name] = conversion{funcName(rcvr, fd.Name.Name), pointer}
+				methods[fd.Name.Name] = true
+			}
+		}
+	}
+
+	//The spec type a method is selected on, and whether the value it is selected on is a pointer
+	recvOf := func(x ast.Expr) (name string, pointer bool, ok bool) {
+		t := decls.typeOf(x)
+		if star, isStar := t.(*ast.StarExpr); isStar {
+			t, pointer = star.X, true
+		}
+		if id, isIdent := t.(*ast.Ident); isIdent {
+			return id.Name, pointer, true
+		}
+		return "", false, false
+	}
+
+	//Calls are rewritten before the methods are converted, so the types of their receivers and results are still known
+	astutil.Apply(file, func(c *astutil.Cursor) bool {
+		call, isCall := c.Node().(*ast.CallExpr)
+		sel, isSel := c.Node().(*ast.SelectorExpr)
+		if isCall {
+			sel, isSel = call.Fun.(*ast.SelectorExpr)
+		} else if _, isCallee := c.Parent().(*ast.CallExpr); isCallee && c.Name() == "Fun" {
+			//Handled with its call
+			return true
+		}
+		if !isSel || !methods[sel.Sel.Name] {
+			return true
+		}
+		if x, isIdent := sel.X.(*ast.Ident); isIdent && x.Obj == nil {
+			//A package or a type, neither of which has methods to convert
+			return true
+		}
+
+		rcvr, pointer, known := recvOf(sel.X)
+		f, found := converted[rcvr+"."+sel.Sel.Name]
+		switch {
+		case known && !found:
+			return true
+		case !known:
+			errors = append(errors, fmt.Errorf("Cannot tell the type of %s, so %s can't be converted to a function", ExprString(sel.X), ExprString(sel)))
+			return true
+		case !isCall:
+			errors = append(errors, fmt.Errorf("%s is used as a method value, which can't be converted to the function %s", ExprString(sel), f.name))
+			return true
+		}
+
+		recv := sel.X
+		switch {
+		case f.pointer && !pointer:
+			if !addressable(recv, decls) {
+				errors = append(errors, fmt.Errorf("%s needs a pointer, but %s can't have its address taken", f.name, ExprString(recv)))
+				return true
+			}
+			recv = &ast.UnaryExpr{Op: token.AND, X: recv}
+		case !f.pointer && pointer:
+			recv = &ast.StarExpr{X: recv}
+		}
+		call.Fun = ast.NewIdent(f.name)
+		call.Args = append([]ast.Expr{recv}, call.Args...)
+		return true
+	}, nil)
+
+	for _, decl := range file.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		rcvr, ok := methodRecieverTypeIdentifier(fd)
+		if !ok || !containsString(receivers, rcvr) {
+			continue
+		}
+
+		field := fd.Recv.List[0]
+		if len(field.Names) == 0 || field.Names[0].Name == "_" {
+			field.Names = []*ast.Ident{ast.NewIdent("recv")}
+		}
+
+		fd.Name = ast.NewIdent(converted[rcvr+"."+fd.Name.Name].name)
+		fd.Type.Params.List = append([]*ast.Field{field}, fd.Type.Params.List...)
+		fd.Recv = nil
+	}
+	return
+}
+
+//The import path of the package in a directory, from its module or its GOPATH
+func importPathOf(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for d := abs; ; d = filepath.Dir(d) {
+		if module, ok := modulePath(filepath.Join(d, "go.mod")); ok {
+			rel, _ := filepath.Rel(d, abs)
+			return path.Join(module, filepath.ToSlash(rel)), nil
+		}
+		if d == filepath.Dir(d) {
+			break
+		}
+	}
+
+	if pkg, err := build.Default.ImportDir(abs, build.FindOnly); err == nil && pkg.ImportPath != "." && pkg.ImportPath != "" {
+		return pkg.ImportPath, nil
+	}
+	return "", fmt.Errorf("Cannot determine the import path of %s, it is in neither a module nor GOPATH", dir)
+}
+
+func modulePath(goMod string) (string, bool) {
+	f, err := os.Open(goMod)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`), true
+		}
+	}
+	return "", false
+}
+
+//The name of the package in a directory, or the directory's name for a new package
+func packageNameOf(dir string) string {
+	built := func(fi os.FileInfo) bool { return isBuiltFile(dir, fi) }
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir, built, parser.PackageClauseOnly)
+	if err == nil {
+		for name := range pkgs {
+			return name
+		}
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return -1
+	}, filepath.Base(dir))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"go/printer"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+const relocateGeneric = `package gen
+type T interface{}
+type Slice []T
+func (s Slice) Len() int { return len(s) }
+func (s Slice) Empty() bool { return s.Len() == 0 }
+func (s Slice) Where(fn func(T) bool) (result Slice) {
+	for _, v := range s {
+		if fn(v) {
+			result = append(result, v)
+		}
+	}
+	return
+}
+func (s Slice) Same(other Slice) bool { return s.Len() == other.Len() && s.Where(nil).Empty() == other.Empty() }
+func (s *Slice) Push(v T) { *s = append(*s, v) }
+func (s Slice) With(v T) Slice {
+	s.Push(v)
+	return s
+}
+func (s *Slice) Clear() bool { return Slice(nil).Empty() || s.Empty() }`
+
+func Test_Relocate(t *testing.T) {
+	tests := []struct {
+		Form   string
+		Expect []string
+	}{
+		{wrapperForm, []string{
+			"package out",
+			`"example.com/users"`,
+			"type Users users.Users",
+			"func (s Users) Where(fn func(*users.User) bool) (result Users)",
+			"return s.Len() == 0",
+		}},
+		{funcForm, []string{
+			"package out",
+			"func UsersWhere(s users.Users, fn func(*users.User) bool) (result users.Users)",
+			"func UsersLen(s users.Users) int",
+			"return UsersLen(s) == 0",
+			"return UsersLen(s) == UsersLen(other) && UsersEmpty(UsersWhere(s, nil)) == UsersEmpty(other)",
+			"UsersPush(&s, v)",
+			"return UsersEmpty(users.Users(nil)) || UsersEmpty(*s)",
+		}},
+	}
+
+	for _, tst := range tests {
+		src, errors := relocateSource(relocateGeneric, "package users\ntype User struct{ Name string }\ntype Users []*User", tst.Form)
+		if len(errors) != 0 {
+			t.Errorf("%s: %v", tst.Form, errors)
+			continue
+		}
+		for _, expect := range tst.Expect {
+			if !strings.Contains(src, expect) {
+				t.Errorf("%s: expected %q in\n%s", tst.Form, expect, src)
+			}
+		}
+	}
+}
+
+func Test_RelocateErrors(t *testing.T) {
+	tests := []string{
+		"package users\ntype user struct{ Name string }\ntype Users []*user",
+		"package main\ntype Ints []int",
+	}
+
+	for _, spec := range tests {
+		if _, errors := relocateSource(relocateGeneric, spec, wrapperForm); len(errors) == 0 {
+			t.Errorf("Expected an error relocating\n%s", spec)
+		}
+	}
+}
+
+func Test_RelocateFuncErrors(t *testing.T) {
+	tests := []string{
+		//Method values can't become functions
+		"func Lengths(s Slice) func() int { return s.Len }",
+		//The type of a range value isn't known
+		"func Total(all []Slice) (n int) {\n\tfor _, s := range all {\n\t\tn += s.Len()\n\t}\n\treturn\n}",
+		//Results of map lookups can't be addressed
+		"func Add(m map[string]Slice, v T) { m[\"\"].Push(v) }",
+	}
+
+	for _, tst := range tests {
+		if _, errors := relocateSource(relocateGeneric+"\n"+tst, "package users\ntype User struct{ Name string }\ntype Users []*User", funcForm); len(errors) == 0 {
+			t.Errorf("Expected an error converting the methods used in\n%s", tst)
+		}
+	}
+}
+
+func relocateSource(gen, spec, form string) (src string, errors []error) {
+	generic, _ := NewSourceStringContext(gen, "gen.go")
+	provider, _ := NewSourceStringContext(spec, "users.go")
+
+	imp := NewImplementor(provider)
+	imp.Output = &outputPackage{Name: "out", SpecPath: "example.com/users", Form: form}
+
+	codes, ok, errors := imp.Transform(generic)
+	if !ok {
+		return
+	}
+
+	var b bytes.Buffer
+	printer.Fprint(&b, token.NewFileSet(), codes[0].File)
+	src = b.String()
+	return
+}
@@ -20,10 +20,14 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"go/ast"
+	"go/format"
 	"go/printer"
 	"go/token"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -44,30 +48,63 @@ type AstTransform interface {
 
 type writeConfig struct {
 	Prefix, Suffix string
+	//Required type bindings and spec types, see Implementor. Part of the config so they are part of cache keys
+	Bindings map[string]string
+	Types    []string
+	//Package to generate into, and the form of methods on spec types there, see outputPackage
+	Package, Form string
+	//Merge every implementation into one file of this name, see mergeSources
+	SingleFile string
+	//Whether spec types are drawn from the spec file or its whole package, see generateJob
+	SpecScope string
+	//The receivers of methods generated on spec types, see receiverPolicy
+	Receivers string
+	//Whether spec aliases that can't have methods are implemented by wrapper types, see aliasWrapper
+	WrapAliases bool
 }
 
-func RewriteFile(genericSourceFile, outputDirectory string, t AstTransform, cfg writeConfig) {
+//Implement a generic source file and write the results to the output directory, returning what was written
+func RewriteFile(genericSourceFile, outputDirectory string, t AstTransform, cfg writeConfig) (codes SourceSet) {
 
 	gen, err := NewFileContext(genericSourceFile)
 	if err != nil {
 		printErrors([]error{err})
+		return nil
 	}
+	return rewriteContext(gen, genericSourceFile, outputDirectory, t, cfg)
+}
 
+//Implement an already parsed generic source file, so one parse can be shared by many spec files
+func rewriteContext(gen *Context, genericSourceFile, outputDirectory string, t AstTransform, cfg writeConfig) (codes SourceSet) {
+	codes = transformContext(gen, genericSourceFile, t, cfg)
+	for _, source := range codes {
+		writeSourceCodeToFile(source, outputDirectory)
+	}
+	return
+}
+
+//Implement an already parsed generic source file, naming the results after the files they're written to
+func transformContext(gen *Context, genericSourceFile string, t AstTransform, cfg writeConfig) (codes SourceSet) {
+	//Transforms that generate for each spec type may still generate for some when others fail
 	codes, ok, errors := t.Transform(gen)
+	printErrors(errors)
 	if !ok {
-		printErrors(errors)
-		return
+		return nil
 	}
 
+	//Files named by the transform itself, such as alias wrappers, keep their names
 	codes.Each(func(s *SourceCode) {
-		srcName := strings.TrimSuffix(filepath.Base(genericSourceFile), filepath.Ext(genericSourceFile))
-		s.Name = strings.ToLower(fmt.Sprintf("%s%s_%s%s.go", cfg.Prefix, s.Name, srcName, cfg.Suffix))
+		if !strings.HasSuffix(s.Name, ".go") {
+			s.Name = generatedFileName(cfg, s.Name, genericSourceFile)
+		}
 	})
+	return
+}
 
-	for _, source := range codes {
-		writeSourceCodeToFile(source, outputDirectory)
-	}
-
+//The name of the file that the implementation of a generic source file for a given spec type is written to
+func generatedFileName(cfg writeConfig, name, genericSourceFile string) string {
+	srcName := strings.TrimSuffix(filepath.Base(genericSourceFile), filepath.Ext(genericSourceFile))
+	return strings.ToLower(fmt.Sprintf("%s%s_%s%s.go", cfg.Prefix, name, srcName, cfg.Suffix))
 }
 
 func printErrors(errors []error) {
@@ -81,5 +118,97 @@ func writeSourceCodeToFile(source *SourceCode, outputDirectory string) {
 
 	printer.Fprint(&b, token.NewFileSet(), source.File)
 	outPath := filepath.Join(outputDirectory, source.Name)
+	os.MkdirAll(outputDirectory, 0755)
 	ioutil.WriteFile(outPath, b.Bytes(), 0644)
 }
+
+//Write source code that was parsed from gofmt'd source, keeping its formatting
+func writeFormattedSourceToFile(source *SourceCode, outputDirectory string) {
+	var b bytes.Buffer
+
+	format.Node(&b, source.FileSet, source.File)
+	os.MkdirAll(outputDirectory, 0755)
+	ioutil.WriteFile(filepath.Join(outputDirectory, source.Name), b.Bytes(), 0644)
+}
+
+//Gofmt the declarations a transform generates for a spec type into a file of the spec package, with the imports they need
+func generatedSource(pkg *Context, name string, imports ImportSpecs, decls []byte) (source *SourceCode, err error) {
+	specs := map[string]bool{}
+	for _, i := range imports {
+		specs[importSpecString(i)] = true
+	}
+	sorted := []string{}
+	for spec := range specs {
+		sorted = append(sorted, spec)
+	}
+	sort.Strings(sorted)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "package %s\n\n", pkg.File.Name.Name)
+	switch len(sorted) {
+	case 0:
+	case 1:
+		fmt.Fprintf(&b, "import %s\n", sorted[0])
+	default:
+		fmt.Fprintf(&b, "import (\n%s\n)\n", strings.Join(sorted, "\n"))
+	}
+	b.Write(decls)
+
+	formatted, err := format.Source(b.Bytes())
+	if err != nil {
+		return
+	}
+
+	ctx, err := NewSourceStringContext(string(formatted), name+".go")
+	if err != nil {
+		return
+	}
+	source = &SourceCode{ctx, name}
+	return
+}
+
+//Run a transform of a spec file that generates into the spec's own package, writing the results next to the spec file
+//The transform is given the rest of the package too, less the files it generated last time,
+//so what it generated isn't mistaken for something the package declares itself
+func transformSpec(specFile, transformFile string, cfg writeConfig, newTransform func(pkg *Context, dir string) AstTransform) {
+	spec, err := NewFileContext(specFile)
+	if err != nil {
+		printErrors([]error{err})
+		return
+	}
+
+	var (
+		dir               = filepath.Dir(specFile)
+		generated         = generatedIn(dir)
+		previous          = map[string]bool{}
+		types     typeSet = spec.Types()
+	)
+	types.Each(func(t *ast.TypeSpec) {
+		previous[generatedFileName(cfg, t.Name.Name, transformFile)] = true
+	})
+
+	pkg, err := NewPackageContext(specFile, func(name string) bool { return previous[name] || generated(name) })
+	if err != nil {
+		printErrors([]error{err})
+		return
+	}
+
+	codes := transformContext(spec, transformFile, newTransform(pkg, dir), cfg)
+	if codes == nil {
+		return
+	}
+	written := []string{}
+	for _, source := range codes {
+		writeFormattedSourceToFile(source, dir)
+		written = append(written, source.Name)
+	}
+	printErrors(recordOutputs(dir, transformEntry(specFile, transformFile, cfg), written))
+}
+
+//Transforms are recorded under a directive of their own, such as go:generate deepcopy, see transformOutputs
+func transformEntry(specFile, transformFile string, cfg writeConfig) manifestEntry {
+	return manifestEntry{
+		Directive: generateDirective + " " + strings.TrimSuffix(transformFile, ".go"),
+		Job:       generateJob{Spec: filepath.Base(specFile), Types: cfg.Types, Prefix: cfg.Prefix, Suffix: cfg.Suffix},
+	}
+}
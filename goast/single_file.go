@@ -0,0 +1,111 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+//The file name of a --single-file output, which may be given without its .go extension
+func singleFileName(name string) string {
+	if strings.HasSuffix(name, ".go") {
+		return name
+	}
+	return name + ".go"
+}
+
+//Merge generated sources into a single gofmt'd file with one import block
+//Sources are merged in order of their names, so the same sources always produce the same file
+func mergeSources(name string, sources []cachedSource) (merged cachedSource, err error) {
+	sorted := append([]cachedSource{}, sources...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var (
+		pkg     string
+		imports = map[string]bool{}
+		decls   bytes.Buffer
+	)
+
+	for _, s := range sorted {
+		fset := token.NewFileSet()
+		file, parseErr := parser.ParseFile(fset, s.Name, s.Source, 0)
+		if parseErr != nil {
+			err = parseErr
+			return
+		}
+
+		if pkg == "" {
+			pkg = file.Name.Name
+		} else if pkg != file.Name.Name {
+			err = fmt.Errorf("Cannot merge %s of package %s into package %s", s.Name, file.Name.Name, pkg)
+			return
+		}
+
+		for _, spec := range file.Imports {
+			imports[importSpecString(spec)] = true
+		}
+
+		//Declarations are copied as written, so formatting within them is kept
+		for _, decl := range file.Decls {
+			if gen, isGenDecl := decl.(*ast.GenDecl); isGenDecl && gen.Tok == token.IMPORT {
+				continue
+			}
+			start, end := fset.Position(decl.Pos()).Offset, fset.Position(decl.End()).Offset
+			decls.Write(s.Source[start:end])
+			decls.WriteString("\n\n")
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	if len(imports) == 1 {
+		for spec := range imports {
+			fmt.Fprintf(&b, "import %s\n\n", spec)
+		}
+	} else if len(imports) > 1 {
+		specs := []string{}
+		for spec := range imports {
+			specs = append(specs, spec)
+		}
+		sort.Strings(specs)
+		fmt.Fprintf(&b, "import (\n\t%s\n)\n\n", strings.Join(specs, "\n\t"))
+	}
+	b.Write(decls.Bytes())
+
+	source, err := format.Source(b.Bytes())
+	if err != nil {
+		err = fmt.Errorf("Cannot merge sources into %s: %s", name, err)
+		return
+	}
+	merged = cachedSource{name, source}
+	return
+}
+
+func importSpecString(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name + " " + spec.Path.Value
+	}
+	return spec.Path.Value
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_MergeSources(t *testing.T) {
+	sources := []cachedSource{
+		{"names_slice.go", []byte("package main\nimport \"strings\"\nfunc (s Names) Join() string { return strings.Join(s, \",\") }")},
+		{"ints_slice.go", []byte("package main\nimport (\n\"fmt\"\n\"strings\"\n)\nfunc (s Ints) String() string { return strings.TrimSpace(fmt.Sprint([]int(s))) }")},
+	}
+
+	expect := `package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func (s Ints) String() string { return strings.TrimSpace(fmt.Sprint([]int(s))) }
+
+func (s Names) Join() string { return strings.Join(s, ",") }
+`
+
+	merged, err := mergeSources("slices.go", sources)
+	if err != nil || merged.Name != "slices.go" || string(merged.Source) != expect {
+		t.Fatalf("Expected merged source\n%s\nfound %s\n%s %v", expect, merged.Name, merged.Source, err)
+	}
+
+	reversed, _ := mergeSources("slices.go", []cachedSource{sources[1], sources[0]})
+	if !reflect.DeepEqual(reversed, merged) {
+		t.Error("Expected merging to not depend on the order of sources")
+	}
+
+	if _, err := mergeSources("slices.go", append(sources, cachedSource{"other.go", []byte("package other")})); err == nil {
+		t.Error("Expected sources of different packages to not merge")
+	}
+}
+
+func Test_GenerateSingleFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	writeTestFiles(dir, map[string]string{
+		"gen/slice.go": manifestGeneric,
+		"app/main.go":  "package main\ntype Ints []int\ntype Names []string",
+		"goast.json":   `{"jobs": [{"generic": "gen/slice.go", "spec": "app/main.go", "single_file": "slices"}]}`,
+	})
+	generate(filepath.Join(dir, "goast.json"), nil)
+
+	if fileExists(filepath.Join(dir, "app", "ints_slice.go")) || fileExists(filepath.Join(dir, "app", "names_slice.go")) {
+		t.Error("Expected a single file instead of a file per spec type")
+	}
+
+	m, _ := loadManifest(filepath.Join(dir, "app"))
+	if len(m.Entries) != 1 || !reflect.DeepEqual(m.Entries[0].Files, []string{"slices.go"}) {
+		t.Errorf("Expected the manifest to record the single file, found %+v", m.Entries)
+	}
+
+	expect := `package main
+
+func (s Ints) First() int {
+	return s[0]
+}
+
+func (s Names) First() string {
+	return s[0]
+}
+`
+	b, err := ioutil.ReadFile(filepath.Join(dir, "app", "slices.go"))
+	if err != nil || string(b) != expect {
+		t.Errorf("Expected slices.go to be\n%s\nfound\n%s %v", expect, b, err)
+	}
+}
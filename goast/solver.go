@@ -0,0 +1,225 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"runtime"
+	"sync"
+)
+
+//Solves a generic file against a set of spec types by unification
+//Generic types are assigned spec types depth-first, from most to least complex, against a single set
+//of bindings. Each assignment propagates the bindings its structure implies (type Collection []I also binds I),
+//so generic types that are bound along the way are never searched for
+//Bindings made by an assignment are undone by depth when it is backtracked, rather than copying the ImplMap each step
+type solver struct {
+	cp        ContextPair
+	implTypes typeSet
+	//The spec types each generic type could be implemented by when nothing else is known
+	domains [][]assignment
+	//The primary spec type, which can't implement any other generic type
+	primary *ast.TypeSpec
+	//Composite generic types that are derived when no spec type implements them, see compositeTypes
+	derivable map[string]bool
+	//Generic types with methods, which can't be implemented by unnamed types
+	receivers map[string]bool
+
+	bindings ImplMap
+	depth    map[string]int
+	impls    implSet
+	//The furthest generic type that couldn't be satisfied, for reporting
+	unsatisfied int
+	//Why the last complete set of bindings was rejected, for reporting
+	err error
+}
+
+//A spec type that can implement a generic type, along with the bindings it implies when nothing else is known
+type assignment struct {
+	Spec     *ast.TypeSpec
+	Bindings ImplMap
+}
+
+//An assignment can only hold if the bindings it implies agree with those already made
+func (a assignment) Consistent(bindings ImplMap) bool {
+	for name, x := range a.Bindings {
+		if bound, exists := bindings[name]; exists && !EquivalentExprs(bound, x) {
+			return false
+		}
+	}
+	return true
+}
+
+//Bindings only ever narrow what a spec type can implement, so a spec type that can't implement a generic
+//type on its own can't implement it in any solution. Checking every pair once up front prunes most of the search
+func domainsOf(cp ContextPair, implTypes, specTypes typeSet) (domains [][]assignment, errors [][]error) {
+	domains = make([][]assignment, implTypes.Len())
+	errors = make([][]error, implTypes.Len())
+
+	parallel(implTypes.Len(), func(i int) {
+		for _, s := range specTypes {
+			if ok, bindings, err := Implement(cp, NewImplMap(), s, implTypes[i]); ok {
+				domains[i] = append(domains[i], assignment{s, bindings})
+			} else {
+				errors[i] = append(errors[i], err)
+			}
+		}
+	})
+	return
+}
+
+func newSolver(cp ContextPair, implTypes typeSet, domains [][]assignment, primary *ast.TypeSpec, primaryMap ImplMap) *solver {
+	s := &solver{
+		cp:        cp,
+		implTypes: implTypes,
+		domains:   domains,
+		primary:   primary,
+		bindings:  primaryMap,
+		depth:     map[string]int{},
+	}
+	s.mark(0)
+	return s
+}
+
+//Find every complete set of bindings for the generic types from i onward
+func (s *solver) search(i int) {
+	if i == s.implTypes.Len() {
+		for name := range s.receivers {
+			if x, bound := s.bindings[name]; bound && isUnnamedType(x) {
+				s.err = fmt.Errorf("Cannot implement %s as %s, methods can only be declared on named types", name, ExprString(x))
+				return
+			}
+		}
+		s.impls = append(s.impls, s.bindings.Copy())
+		return
+	}
+
+	if i > s.unsatisfied {
+		s.unsatisfied = i
+	}
+
+	g := s.implTypes[i]
+
+	//Already bound through the structure of another generic type
+	if _, bound := s.bindings[g.Name.Name]; bound {
+		s.search(i + 1)
+		return
+	}
+
+	found := s.impls.Len()
+	for _, a := range s.domains[i] {
+		if a.Spec == s.primary || !a.Consistent(s.bindings) {
+			continue
+		}
+
+		ok, _ := implementType(s.cp, s.bindings, g, a.Spec)
+		if ok {
+			ok, _ = s.bindings.Store(g.Name.Name, a.Spec.Name)
+		}
+
+		if ok {
+			s.mark(i + 1)
+			s.search(i + 1)
+		}
+		s.undo(i + 1)
+	}
+
+	//Only derived when the spec doesn't provide the type
+	if !s.derivable[g.Name.Name] || s.impls.Len() != found {
+		return
+	}
+	if name, ok := derivedTypeName(s.cp.Generic, g, s.bindings); ok {
+		s.bindings.Store(g.Name.Name, derivedIdent(name))
+		s.mark(i + 1)
+		s.search(i + 1)
+		s.undo(i + 1)
+	}
+}
+
+//Record the depth of bindings made since the last mark
+func (s *solver) mark(depth int) {
+	for name := range s.bindings {
+		if _, marked := s.depth[name]; !marked {
+			s.depth[name] = depth
+		}
+	}
+}
+
+//Remove every binding made at a depth, along with any left behind by a failed assignment
+func (s *solver) undo(depth int) {
+	for name := range s.bindings {
+		if d, marked := s.depth[name]; !marked || d >= depth {
+			delete(s.bindings, name)
+			delete(s.depth, name)
+		}
+	}
+}
+
+//Run fn for 0 to n-1, spread across the available processors
+func parallel(n int, fn func(int)) {
+	var (
+		wg    sync.WaitGroup
+		slots = make(chan bool, runtime.GOMAXPROCS(0))
+	)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		slots <- true
+		go func(i int) {
+			defer func() { <-slots; wg.Done() }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+//Solve every candidate for the primary generic type concurrently, keeping candidates in their original order
+//Composite generic types are only derived when derivable is given, see derivingOrder
+func solveCandidates(cp ContextPair, implTypes typeSet, domains [][]assignment, errs [][]error, derivable map[string]bool) (solutions []Solution, errors []error) {
+	var (
+		candidates = domains[0]
+		results    = make([]*solver, len(candidates))
+		receivers  = receiverTypes(cp.Generic)
+	)
+
+	parallel(len(candidates), func(i int) {
+		c := candidates[i]
+		s := newSolver(cp, implTypes, domains, c.Spec, c.Bindings.Copy())
+		s.derivable, s.receivers = derivable, receivers
+		s.search(1)
+		results[i] = s
+	})
+
+	for i, s := range results {
+		if s.impls.Len() != 0 {
+			solutions = append(solutions, Solution{candidates[i].Spec, s.impls})
+			continue
+		}
+
+		//Save an error in case there is no implementation possible
+		if s.err != nil {
+			errors = append(errors, s.err)
+			continue
+		}
+		g := implTypes[s.unsatisfied]
+		errors = append(errors, errs[s.unsatisfied]...)
+		errors = append(errors, fmt.Errorf("Unable to satisfy generic type %s with any of the specification types.", g.Name.Name))
+	}
+	return
+}
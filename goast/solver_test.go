@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const solverGeneric = `package gen
+type K interface{}
+type V interface{}
+type Pair struct {
+	Key   K
+	Value V
+}
+type Pairs []Pair
+type Index map[K]Pairs
+type Values []V
+type Keys []K`
+
+//A spec package with n types, a fifth of which implement each generic type
+func syntheticSpec(n int) string {
+	src := []string{"package main"}
+	for i := 0; i < n; i++ {
+		switch i % 5 {
+		case 0:
+			src = append(src, fmt.Sprintf("type Index%d map[string]Pairs%d", i, i+1))
+		case 1:
+			src = append(src, fmt.Sprintf("type Pairs%d []Pair%d", i, i+1))
+		case 2:
+			src = append(src, fmt.Sprintf("type Pair%d struct{ Key string; Value int }", i))
+		case 3:
+			src = append(src, fmt.Sprintf("type Ints%d []int", i))
+		case 4:
+			src = append(src, fmt.Sprintf("type Strings%d []string", i))
+		}
+	}
+	return strings.Join(src, "\n")
+}
+
+func Benchmark_Solve(b *testing.B) {
+	for _, n := range []int{10, 40, 80} {
+		gen, _ := NewSourceStringContext(solverGeneric, "gen.go")
+		spec, _ := NewSourceStringContext(syntheticSpec(n), "spec.go")
+		imp := NewImplementor(spec)
+
+		b.Run(fmt.Sprintf("%dTypes", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				imp.Solve(gen)
+			}
+		})
+	}
+}
+
+func Test_Solve(t *testing.T) {
+	gen, _ := NewSourceStringContext(solverGeneric, "gen.go")
+	spec, _ := NewSourceStringContext(syntheticSpec(10), "spec.go")
+
+	solutions, errors := NewImplementor(spec).Solve(gen)
+	if len(solutions) != 2 {
+		t.Fatalf("Expected 2 solutions, found %d. Errors: %v", len(solutions), errors)
+	}
+
+	for i, solution := range solutions {
+		if name := fmt.Sprintf("Index%d", i*5); solution.Spec.Name.Name != name {
+			t.Errorf("Expected solution for %s, found %s", name, solution.Spec.Name.Name)
+		}
+
+		//Values and Keys can each be implemented by either of the two spec types with their element type
+		if len(solution.Impls) != 4 {
+			t.Errorf("Expected 4 implementations of %s, found %d", solution.Spec.Name.Name, len(solution.Impls))
+		}
+
+		for _, imap := range solution.Impls {
+			if ExprString(imap["V"]) != "int" || ExprString(imap["K"]) != "string" {
+				t.Errorf("Expected K->string and V->int, found\n%s", imap)
+			}
+		}
+	}
+}
+
+func Test_SolveUnsatisfiable(t *testing.T) {
+	gen, _ := NewSourceStringContext(solverGeneric, "gen.go")
+	spec, _ := NewSourceStringContext(`package main
+		type Index map[string]Pairs
+		type Pairs []Pair
+		type Pair struct{ Key string; Value int }
+		type Ints []int`, "spec.go")
+
+	solutions, errors := NewImplementor(spec).Solve(gen)
+	if len(solutions) != 0 || len(errors) == 0 {
+		t.Errorf("Expected no solutions without a Keys implementation, found %d", len(solutions))
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"go/ast"
+)
+
+//A field that can be selected on a struct, either declared directly on the struct
+//or promoted from one of its embedded fields
+type StructField struct {
+	*ast.Field
+	Name string
+	//The embedded fields traversed to reach this field, outermost first
+	Path []*ast.Field
+}
+
+//Depth of the field within the struct; 0 for fields declared directly on the struct
+func (f StructField) Depth() int {
+	return len(f.Path)
+}
+
+func (f StructField) IsEmbedded() bool {
+	return len(f.Field.Names) == 0
+}
+
+//All selectable fields of a struct type, ordered from shallowest to deepest
+//Promotion follows the Go spec: a name at a shallower depth hides that name at any deeper depth,
+//and a name declared more than once at the same depth can't be selected at all
+func (c *Context) FieldsOf(s *ast.StructType) (fields []StructField) {
+	type embedding struct {
+		*ast.StructType
+		path []*ast.Field
+	}
+
+	var (
+		hidden  = map[string]bool{}
+		visited = map[*ast.StructType]bool{s: true}
+		level   = []embedding{{s, nil}}
+	)
+
+	for len(level) > 0 {
+		var (
+			found  []StructField
+			next   []embedding
+			counts = map[string]int{}
+		)
+
+		for _, e := range level {
+			if e.Fields == nil {
+				continue
+			}
+
+			for _, field := range e.Fields.List {
+				for _, name := range fieldNames(field) {
+					if !hidden[name] {
+						counts[name] += 1
+						found = append(found, StructField{field, name, e.path})
+					}
+				}
+
+				if len(field.Names) != 0 {
+					continue
+				}
+
+				//Embedded structs get walked at the next depth, guarding against recursive embedding through pointers
+				if st, ok := c.structOf(field.Type); ok && !visited[st] {
+					path := append(append([]*ast.Field{}, e.path...), field)
+					next = append(next, embedding{st, path})
+				}
+			}
+		}
+
+		for _, f := range found {
+			if counts[f.Name] == 1 {
+				fields = append(fields, f)
+			}
+		}
+
+		for name := range counts {
+			hidden[name] = true
+		}
+
+		for _, e := range next {
+			visited[e.StructType] = true
+		}
+		level = next
+	}
+	return
+}
+
+//Find a field that can be selected on a struct by name, including fields promoted from embedded structs
+func (c *Context) LookupField(s *ast.StructType, name string) (field StructField, ok bool) {
+	for _, field = range c.FieldsOf(s) {
+		if ok = (field.Name == name); ok {
+			return
+		}
+	}
+	field = StructField{}
+	return
+}
+
+//Resolve an expression to the struct type it declares or names, if any
+//Types declared outside of the context's package can't be resolved
+func (c *Context) structOf(x ast.Expr) (*ast.StructType, bool) {
+	seen := map[string]bool{}
+	for {
+		switch t := x.(type) {
+		case *ast.StructType:
+			return t, true
+
+		case *ast.StarExpr:
+			x = t.X
+
+		case *ast.ParenExpr:
+			x = t.X
+
+		case *ast.Ident:
+			spec, isType := c.LookupType(t.Name)
+			if !isType || seen[t.Name] {
+				return nil, false
+			}
+			seen[t.Name] = true
+			x = spec.Type
+
+		default:
+			return nil, false
+		}
+	}
+}
+
+//The names a field can be selected by. Embedded fields are implicitly named after their type
+func fieldNames(field *ast.Field) (names []string) {
+	if len(field.Names) == 0 {
+		if name, ok := embeddedFieldName(field.Type); ok {
+			names = append(names, name)
+		}
+		return
+	}
+
+	for _, ident := range field.Names {
+		names = append(names, ident.Name)
+	}
+	return
+}
+
+//The implicit field name of an embedded type; T, *T and pkg.T are all named T
+func embeddedFieldName(x ast.Expr) (name string, ok bool) {
+	switch t := x.(type) {
+	case *ast.Ident:
+		return t.Name, true
+
+	case *ast.StarExpr:
+		return embeddedFieldName(t.X)
+
+	case *ast.ParenExpr:
+		return embeddedFieldName(t.X)
+
+	case *ast.SelectorExpr:
+		return t.Sel.Name, true
+
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,342 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//What deep copy and equality generation share: which types are generated for,
+//and how the types of their fields are resolved, a field at a time
+type structural struct {
+	methodResolver
+	//Types to generate for. Every type in the spec file other than interfaces when empty
+	Types []string
+	//Whether to track the pointers already visited, so values with cycles through pointers can be handled
+	Cycles bool
+
+	//Types generated for, which are handled by calling their generated method
+	selected map[string]bool
+	//Named types whose declarations are being expanded, so recursive types that aren't generated for are reported
+	expanding map[string]bool
+	imports   ImportSpecs
+	vars      int
+}
+
+func newStructural(pkg *Context, dir string, types []string, cycles bool) structural {
+	return structural{newMethodResolver(pkg, dir), types, cycles, map[string]bool{}, map[string]bool{}, nil, 0}
+}
+
+//The types of a spec file to generate a method for, skipping those that already declare it
+func (s *structural) specTypes(spec *Context, method string) (specs []*ast.TypeSpec, errors []error) {
+	var types typeSet = spec.Types()
+	types.Each(func(t *ast.TypeSpec) {
+		name := t.Name.Name
+		if len(s.Types) != 0 && !containsString(s.Types, name) {
+			return
+		}
+
+		_, isInterface := t.Type.(*ast.InterfaceType)
+		switch {
+		case isInterface || t.TypeParams != nil:
+			if len(s.Types) != 0 {
+				errors = append(errors, fmt.Errorf("Cannot generate %s for %s, it's an interface or generic", method, name))
+			}
+		case s.hasMethod(t.Name, method):
+		default:
+			specs = append(specs, t)
+			s.selected[name] = true
+		}
+	})
+	return
+}
+
+//Start generating a method, forgetting the imports and variables of the last
+func (s *structural) reset() {
+	s.imports, s.vars = nil, 0
+}
+
+//The source of a type, noting the imports it needs
+func (s *structural) spell(x ast.Expr) string {
+	s.imports = append(s.imports, s.Package.SelectedImports(x)...)
+	return ExprString(x)
+}
+
+//A variable name that isn't used by the method being generated yet
+func (s *structural) newVar(prefix string) string {
+	s.vars++
+	return prefix + strconv.Itoa(s.vars-1)
+}
+
+//Whether a named type has a method the generated code can call in place of expanding its declaration,
+//Clone() T or Equal(T) bool
+func (s *structural) hasMethod(x ast.Expr, method string) bool {
+	var name string
+	switch t := x.(type) {
+	case *ast.Ident:
+		name = t.Name
+	case *ast.SelectorExpr:
+		name = t.Sel.Name
+	default:
+		return false
+	}
+
+	methods, err := s.methodsOf(s.Package, nil, x, map[string]bool{})
+	if err != nil {
+		return false
+	}
+	for _, m := range methods {
+		if m.Name != method {
+			continue
+		}
+		params, results := m.Type.Params, m.Type.Results
+		if results == nil || len(results.List) != 1 || results.NumFields() != 1 {
+			return false
+		}
+		switch method {
+		case "Clone":
+			return params.NumFields() == 0 && ExprString(results.List[0].Type) == name
+		case "Equal":
+			return params.NumFields() == 1 && ExprString(params.List[0].Type) == name && ExprString(results.List[0].Type) == "bool"
+		}
+	}
+	return false
+}
+
+//Whether the generated method has to be called for a named type, rather than handling its declaration in place
+func (s *structural) callsMethod(x ast.Expr, method string) bool {
+	if id, isIdent := x.(*ast.Ident); isIdent && s.selected[id.Name] {
+		return true
+	}
+	return s.hasMethod(x, method)
+}
+
+//Expand a named type of the spec package to its declaration, or report that it's predeclared
+//Expanding a type that's already being expanded would never finish, so it has to be generated for instead
+func (s *structural) expand(id *ast.Ident, method string) (decl ast.Expr, predeclared bool, err error) {
+	spec, isType := s.Package.LookupType(id.Name)
+	if !isType {
+		return nil, true, nil
+	}
+	if s.expanding[id.Name] {
+		return nil, false, fmt.Errorf("%s is recursive, generate %s for it too with --type", id.Name, method)
+	}
+	if spec.TypeParams != nil {
+		return nil, false, fmt.Errorf("%s is generic, only its instantiations can be expanded", id.Name)
+	}
+	return spec.Type, false, nil
+}
+
+//Whether assignment copies, or == compares, the whole of a value of a type
+//Funcs can be assigned but not compared. Interfaces are copied by their dynamic value, but == panics on
+//dynamic values that aren't comparable, so they are compared like reflect.DeepEqual would instead
+func (s *structural) flat(x ast.Expr, method string) bool {
+	switch t := x.(type) {
+	case *ast.ParenExpr:
+		return s.flat(t.X, method)
+
+	case *ast.Ident:
+		if s.callsMethod(t, method) {
+			return false
+		}
+		decl, predeclared, err := s.expand(t, method)
+		if predeclared {
+			return method != "Equal" || !isPredeclaredInterface(t)
+		}
+		if err != nil {
+			return false
+		}
+		s.expanding[t.Name] = true
+		defer delete(s.expanding, t.Name)
+		return s.flat(decl, method)
+
+	case *ast.SelectorExpr:
+		if s.hasMethod(t, method) {
+			return false
+		}
+		pkg, _, err := s.importedPackage(s.Package, t)
+		if err != nil {
+			return true
+		}
+		foreign := ast.NewIdent(t.Sel.Name)
+		if method == "Equal" && s.foreignInterfaces(pkg, foreign, map[*ast.TypeSpec]bool{}) {
+			return false
+		}
+		return s.foreignFlat(pkg, foreign, method, map[*ast.TypeSpec]bool{})
+
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		if inst, ok := s.Package.Instantiate(t); ok {
+			return s.flat(inst, method)
+		}
+		return false
+
+	case *ast.ArrayType:
+		return t.Len != nil && s.flat(t.Elt, method)
+
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if optedOut(field) || !s.flat(field.Type, method) {
+				return false
+			}
+		}
+		return true
+
+	case *ast.FuncType:
+		return method == "Clone"
+
+	case *ast.InterfaceType:
+		return method != "Equal"
+
+	case *ast.ChanType:
+		return true
+
+	default:
+		return false
+	}
+}
+
+//Whether an identifier is the predeclared error or any, rather than a type of the spec package
+func isPredeclaredInterface(id *ast.Ident) bool {
+	return id.Name == "error" || id.Name == "any"
+}
+
+//Whether a type of another package is, or directly holds, an interface, as far as its declaration can be found
+func (s *structural) foreignInterfaces(pkg *Context, x ast.Expr, seen map[*ast.TypeSpec]bool) bool {
+	switch t := x.(type) {
+	case *ast.ParenExpr:
+		return s.foreignInterfaces(pkg, t.X, seen)
+
+	case *ast.Ident:
+		spec, isType := pkg.LookupType(t.Name)
+		if !isType {
+			return isPredeclaredInterface(t)
+		}
+		if seen[spec] || spec.TypeParams != nil {
+			return false
+		}
+		seen[spec] = true
+		return s.foreignInterfaces(pkg, spec.Type, seen)
+
+	case *ast.SelectorExpr:
+		imported, _, err := s.importedPackage(pkg, t)
+		if err != nil {
+			return false
+		}
+		return s.foreignInterfaces(imported, ast.NewIdent(t.Sel.Name), seen)
+
+	case *ast.ArrayType:
+		return t.Len != nil && s.foreignInterfaces(pkg, t.Elt, seen)
+
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if s.foreignInterfaces(pkg, field.Type, seen) {
+				return true
+			}
+		}
+
+	case *ast.InterfaceType:
+		return true
+	}
+	return false
+}
+
+//Whether a type of another package is copied, or compared, whole by assignment or ==, as far as its declaration can be found
+//Its unexported fields can't be reached from the spec package, so whatever it points to is shared by a copy.
+//The maps, slices and funcs it holds directly are not: a copy would share them, and == doesn't compile
+func (s *structural) foreignFlat(pkg *Context, x ast.Expr, method string, seen map[*ast.TypeSpec]bool) bool {
+	switch t := x.(type) {
+	case *ast.ParenExpr:
+		return s.foreignFlat(pkg, t.X, method, seen)
+
+	case *ast.Ident:
+		spec, isType := pkg.LookupType(t.Name)
+		if !isType || seen[spec] || spec.TypeParams != nil {
+			return true
+		}
+		seen[spec] = true
+		return s.foreignFlat(pkg, spec.Type, method, seen)
+
+	case *ast.SelectorExpr:
+		imported, _, err := s.importedPackage(pkg, t)
+		if err != nil {
+			return true
+		}
+		return s.foreignFlat(imported, ast.NewIdent(t.Sel.Name), method, seen)
+
+	case *ast.ArrayType:
+		return t.Len != nil && s.foreignFlat(pkg, t.Elt, method, seen)
+
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if !s.foreignFlat(pkg, field.Type, method, seen) {
+				return false
+			}
+		}
+		return true
+
+	case *ast.FuncType:
+		return method == "Clone"
+
+	case *ast.MapType:
+		return false
+
+	default:
+		return true
+	}
+}
+
+//Whether a field has opted out of generated methods with a goast:"-" tag
+func optedOut(field *ast.Field) bool {
+	if field.Tag == nil {
+		return false
+	}
+	tag, err := strconv.Unquote(field.Tag.Value)
+	return err == nil && reflect.StructTag(tag).Get("goast") == "-"
+}
+
+//Strips the parentheses of a dereference such as (*p), which assignments don't need
+func unparen(s string) string {
+	if !strings.HasPrefix(s, "(*") || !strings.HasSuffix(s, ")") {
+		return s
+	}
+	depth := 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 && i != len(s)-1 {
+				return s
+			}
+		}
+	}
+	return s[1 : len(s)-1]
+}
+
+//Select a field or method of a value. Pointers to structs are dereferenced implicitly, so (*p).f is just p.f
+func selector(s, name string) string {
+	if u := unparen(s); u != s {
+		s = u[1:]
+	}
+	return s + "." + name
+}
@@ -0,0 +1,286 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+func hasTypeParams(gen *Context) bool {
+	var genTypes typeSet = gen.Types()
+	return genTypes.Any(func(t *ast.TypeSpec) bool { return t.TypeParams != nil })
+}
+
+//Lower a generic source written with Go type parameters into goast's meta-code, so that it can be
+//implemented like any other generic. type Slice[T any] []T becomes type T interface{}; type Slice []T
+//Type parameters are identified by name, so a parameter has to be declared with the same constraint everywhere
+//and generic types can only be instantiated with their own parameters, e.g. Slice[T] but not Slice[int]
+//Unexported generic types aren't expected from the spec and become related types, so sorter[T] becomes sorter_
+//The constraint of each type parameter is returned so that solutions can be checked against them
+func LowerTypeParams(gen *Context) (lowered *Context, constraints map[string]ast.Expr, errors []error) {
+	constraints = map[string]ast.Expr{}
+
+	gen, err := gen.Clone()
+	if err != nil {
+		errors = append(errors, err)
+		return
+	}
+
+	params := []string{}
+	declare := func(list *ast.FieldList) {
+		if list == nil {
+			return
+		}
+		for _, field := range list.List {
+			for _, name := range field.Names {
+				if prev, exists := constraints[name.Name]; exists {
+					if !EquivalentExprs(prev, field.Type) {
+						errors = append(errors, fmt.Errorf("Type parameter %s is declared with different constraints, %s and %s", name.Name, ExprString(prev), ExprString(field.Type)))
+					}
+					continue
+				}
+				constraints[name.Name] = field.Type
+				params = append(params, name.Name)
+			}
+		}
+	}
+
+	names := map[*ast.TypeSpec]string{}
+	for _, t := range gen.Types() {
+		if t.TypeParams == nil {
+			continue
+		}
+		declare(t.TypeParams)
+		names[t] = t.Name.Name
+		if !ast.IsExported(t.Name.Name) {
+			names[t] += "_"
+		}
+	}
+
+	for _, f := range gen.Funcs() {
+		declare(f.Type.TypeParams)
+	}
+
+	for _, p := range params {
+		if _, exists := gen.LookupType(p); exists {
+			errors = append(errors, fmt.Errorf("Type parameter %s has the same name as a declared type", p))
+		}
+	}
+
+	//Constraints declared in the generic are only needed to check solutions, they aren't types to implement
+	isConstraint := map[*ast.TypeSpec]bool{}
+	for p, constraint := range constraints {
+		if id, ok := constraint.(*ast.Ident); ok {
+			if spec, declared := gen.LookupType(id.Name); declared {
+				if _, isInterface := spec.Type.(*ast.InterfaceType); isInterface {
+					constraints[p] = spec.Type
+					isConstraint[spec] = true
+				}
+			}
+		}
+	}
+
+	astutil.Apply(gen.File, func(c *astutil.Cursor) bool {
+		switch t := c.Node().(type) {
+		case *ast.IndexExpr, *ast.IndexListExpr:
+			base, indices := indexExprParts(t.(ast.Expr))
+			id, isIdent := base.(*ast.Ident)
+			if !isIdent {
+				return true
+			}
+
+			spec, isType := typeSpecOf(id)
+			name, isGeneric := names[spec]
+			if !isType || !isGeneric {
+				return true
+			}
+
+			if !instantiatesOwnParams(indices, spec.TypeParams) {
+				errors = append(errors, fmt.Errorf("Cannot implement %s, generic types can only be instantiated with their own type parameters", ExprString(t.(ast.Expr))))
+				return true
+			}
+
+			c.Replace(&ast.Ident{NamePos: id.Pos(), Name: name})
+
+		case *ast.Ident:
+			if spec, isType := typeSpecOf(t); isType {
+				if name, isGeneric := names[spec]; isGeneric {
+					t.Name = name
+				}
+			}
+		}
+		return true
+	}, nil)
+
+	if len(errors) != 0 {
+		return
+	}
+
+	for t := range names {
+		t.TypeParams = nil
+	}
+
+	filterTypeSpecs(gen.File, func(t *ast.TypeSpec) bool {
+		return !isConstraint[t]
+	})
+
+	for _, f := range gen.Funcs() {
+		f.Type.TypeParams = nil
+	}
+
+	//Each parameter gets a declaration of its own, only the first spec of a declaration is considered a type
+	for _, p := range params {
+		gen.File.Decls = append(gen.File.Decls, &ast.GenDecl{
+			Tok: token.TYPE,
+			Specs: []ast.Spec{&ast.TypeSpec{
+				Name: ast.NewIdent(p),
+				Type: &ast.InterfaceType{Methods: &ast.FieldList{}},
+			}},
+		})
+	}
+
+	//Reparse so that the new declarations are in scope
+	lowered, err = gen.Clone()
+	if err != nil {
+		errors = append(errors, err)
+	}
+	return
+}
+
+func instantiatesOwnParams(indices []ast.Expr, params *ast.FieldList) bool {
+	i := 0
+	for _, field := range params.List {
+		for _, name := range field.Names {
+			if i >= len(indices) {
+				return false
+			}
+			if id, ok := indices[i].(*ast.Ident); !ok || id.Name != name.Name {
+				return false
+			}
+			i++
+		}
+	}
+	return i == len(indices)
+}
+
+//Drop the mappings of a solution that bind a type parameter to a type outside of its constraint
+func (imp *Implementor) satisfying(solution Solution, constraints map[string]ast.Expr) (result Solution, err error) {
+	result.Spec = solution.Spec
+	for _, imap := range solution.Impls {
+		satisfied := true
+		for param, constraint := range constraints {
+			if x, bound := imap[param]; bound && !imp.TypeProvider.Satisfies(x, constraint) {
+				satisfied = false
+				err = fmt.Errorf("Cannot implement %s with %s, %s does not satisfy %s", param, ExprString(x), ExprString(x), ExprString(constraint))
+				break
+			}
+		}
+		if satisfied {
+			result.Impls = append(result.Impls, imap)
+		}
+	}
+	return
+}
+
+//Whether a type satisfies a constraint, as far as can be told from syntax
+//Unions of type terms and comparable are checked, method sets and named constraints are left to the compiler
+func (c *Context) Satisfies(x, constraint ast.Expr) bool {
+	switch t := constraint.(type) {
+	case *ast.Ident:
+		if t.Name == "comparable" && t.Obj == nil {
+			return c.isComparable(x)
+		}
+		if isBasicType(t.Name) {
+			return EquivalentExprs(x, t)
+		}
+		return true
+
+	case *ast.ParenExpr:
+		return c.Satisfies(x, t.X)
+
+	case *ast.BinaryExpr:
+		if t.Op == token.OR {
+			return c.Satisfies(x, t.X) || c.Satisfies(x, t.Y)
+		}
+
+	case *ast.UnaryExpr:
+		if t.Op == token.TILDE {
+			return EquivalentExprs(c.underlyingType(x), c.underlyingType(t.X))
+		}
+
+	case *ast.InterfaceType:
+		//Embedded type terms restrict the type set, methods can't be checked without type information
+		for _, field := range t.Methods.List {
+			if len(field.Names) == 0 && !c.Satisfies(x, field.Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return true
+}
+
+//Follow declared types down to the type literal or predeclared type they are defined as
+func (c *Context) underlyingType(x ast.Expr) ast.Expr {
+	seen := map[string]bool{}
+	for {
+		id, isIdent := x.(*ast.Ident)
+		if !isIdent || seen[id.Name] {
+			return x
+		}
+		spec, isType := c.LookupType(id.Name)
+		if !isType {
+			return x
+		}
+		seen[id.Name] = true
+		x = spec.Type
+	}
+}
+
+func (c *Context) isComparable(x ast.Expr) bool {
+	switch t := c.underlyingType(x).(type) {
+	case *ast.ArrayType:
+		return t.Len != nil && c.isComparable(t.Elt)
+
+	case *ast.MapType, *ast.FuncType:
+		return false
+
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if !c.isComparable(field.Type) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isBasicType(name string) bool {
+	switch name {
+	case "bool", "string", "byte", "rune", "uintptr",
+		"int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64",
+		"float32", "float64", "complex64", "complex128":
+		return true
+	}
+	return false
+}
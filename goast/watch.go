@@ -0,0 +1,148 @@
+/*
+Copyright 2014 James Garfield. All rights reserved.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+//Keeps generated code up to date by polling, so no platform specific file notifications are needed
+//Each poll hashes the raw bytes of every job's generic files and spec package. Only when those change
+//are the relevant declarations hashed (see generationKey), and only jobs whose declarations changed are rerun
+type watcher struct {
+	Target string
+	Cache  *generationCache
+
+	//Hashes of raw source and of declarations, by job
+	raw, keys map[string]string
+	//The last diagnostics reported for each job, so unchanged problems aren't reported every poll
+	reported map[string]string
+}
+
+func newWatcher(target string, cache *generationCache) *watcher {
+	return &watcher{
+		Target:   target,
+		Cache:    cache,
+		raw:      map[string]string{},
+		keys:     map[string]string{},
+		reported: map[string]string{},
+	}
+}
+
+//Identifies a job across polls
+func (job generateJob) String() string {
+	return fmt.Sprintf("%s on %s %v", job.Generic, job.Spec, job.config())
+}
+
+//Rerun every job that has changed since the last poll, returning the jobs that were run
+func (w *watcher) Poll() (ran []generateJob) {
+	root, jobs, errors := generateJobs(w.Target)
+	w.report(w.Target, errors)
+
+	g := newGenerator(root, w.Cache)
+	for _, job := range jobs {
+		id := job.String()
+
+		raw, err := w.rawHash(g, job)
+		if err != nil {
+			w.report(id, []error{err})
+			continue
+		}
+		if raw == w.raw[id] {
+			continue
+		}
+		w.raw[id] = raw
+
+		key, err := g.Key(job)
+		if err != nil {
+			w.report(id, []error{err})
+			continue
+		}
+		if key == w.keys[id] {
+			continue
+		}
+
+		fmt.Printf("%s Implement %s on %s\n", time.Now().Format("15:04:05"), job.Generic, job.Spec)
+		w.reported[id] = ""
+		printErrors(g.Run(job))
+		ran = append(ran, job)
+
+		//Generated files are part of the spec package, so hash it again as it is now
+		fresh := newGenerator(root, nil)
+		w.raw[id], _ = w.rawHash(fresh, job)
+		w.keys[id], _ = fresh.Key(job)
+	}
+	return
+}
+
+//Report diagnostics inline, unless they are the same as last time
+func (w *watcher) report(id string, errors []error) {
+	var b strings.Builder
+	for _, e := range errors {
+		b.WriteString(e.Error())
+	}
+	if b.String() == w.reported[id] {
+		return
+	}
+	w.reported[id] = b.String()
+
+	if len(errors) != 0 {
+		fmt.Printf("%s %s\n", time.Now().Format("15:04:05"), id)
+		printErrors(errors)
+	}
+}
+
+//Hash the raw bytes of every file a job reads
+func (w *watcher) rawHash(g *generator, job generateJob) (hash string, err error) {
+	files, err := g.genericFiles(job.Generic)
+	if err != nil {
+		return
+	}
+
+	specs, _ := filepath.Glob(filepath.Join(filepath.Dir(g.path(job.Spec)), "*.go"))
+	sort.Strings(specs)
+
+	h := sha256.New()
+	for _, file := range append(files, specs...) {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %d\n", file, len(b))
+		h.Write(b)
+	}
+	hash = hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+//Poll forever
+func watch(target string, interval time.Duration, cache *generationCache) {
+	w := newWatcher(target, cache)
+	fmt.Printf("Watching %s every %s\n", target, interval)
+	for {
+		w.Poll()
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_WatchPoll(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "goast")
+	defer os.RemoveAll(dir)
+
+	genFile := filepath.Join(dir, "slice.go")
+	specFile := filepath.Join(dir, "app", "main.go")
+	os.MkdirAll(filepath.Dir(specFile), 0755)
+	ioutil.WriteFile(genFile, []byte("package gen\ntype T interface{}\ntype Slice []T\nfunc (s Slice) First() T { return s[0] }"), 0644)
+
+	config := filepath.Join(dir, "goast.json")
+	ioutil.WriteFile(config, []byte(`{"jobs": [{"generic": "slice.go", "spec": "app/main.go"}]}`), 0644)
+
+	tests := []struct {
+		Spec string
+		Runs int
+	}{
+		{"package main\ntype Ints []int\nfunc main() {}", 1},
+		//Nothing changed since the generated file was written
+		{"", 0},
+		//Function bodies aren't relevant declarations
+		{"package main\ntype Ints []int\nfunc main() { println() }", 0},
+		{"package main\ntype Ints []int64\nfunc main() { println() }", 1},
+	}
+
+	w := newWatcher(config, nil)
+	for i, tst := range tests {
+		if tst.Spec != "" {
+			ioutil.WriteFile(specFile, []byte(tst.Spec), 0644)
+		}
+		if ran := w.Poll(); len(ran) != tst.Runs {
+			t.Errorf("Poll %d: expected %d jobs to run, found %d", i, tst.Runs, len(ran))
+		}
+	}
+
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "app", "ints_slice.go")); err != nil || !strings.Contains(string(b), "func (s Ints) First() int64") {
+		t.Errorf("Expected the implementation to be regenerated, found %q %v", b, err)
+	}
+}